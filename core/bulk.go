@@ -0,0 +1,146 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// BulkItem is one document to index with _bulk.
+type BulkItem struct {
+	Action  string // index, or create to refuse overwriting, index if empty
+	Index   string
+	ID      string // generated by ES if empty
+	Routing string
+	Source  json.RawMessage
+}
+
+// Size returns the bytes the item takes in a _bulk body, roughly.
+func (i BulkItem) Size() int {
+	return len(i.Index) + len(i.ID) + len(i.Routing) + len(i.Source) + 64
+}
+
+func (i BulkItem) encode(buf *bytes.Buffer) error {
+	action := i.Action
+	if action == "" {
+		action = "index"
+	}
+	meta := M{"_index": i.Index}
+	if i.ID != "" {
+		meta["_id"] = i.ID
+	}
+	if i.Routing != "" {
+		meta["routing"] = i.Routing
+	}
+	b, err := json.Marshal(M{action: meta})
+	if err != nil {
+		return MarshalErr(err)
+	}
+	buf.Write(b)
+	buf.WriteByte('\n')
+	if err := json.Compact(buf, i.Source); err != nil {
+		return MarshalErr(fmt.Errorf("source of document %v: %w", i.ID, err))
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// BulkResult is the outcome of one BulkItem.
+type BulkResult struct {
+	Index  string        `json:"_index"`
+	ID     string        `json:"_id"`
+	Status int           `json:"status"`
+	Error  *ESErrorCause `json:"error,omitempty"`
+}
+
+// Failed reports whether the item was rejected.
+func (r BulkResult) Failed() bool {
+	return r.Status >= http.StatusMultipleChoices || r.Error != nil
+}
+
+// Bulk indexes the items with _bulk and returns their results in order. The
+// items rejected with a 429 are sent again, alone, according to the retry
+// policy of the client, the last of their results being kept. A request
+// holding items without ID is not sent again when it fails as a whole, since
+// ES may have indexed some of them already.
+func (e *ESClient) Bulk(ctx context.Context, items []BulkItem) ([]BulkResult, error) {
+	results := make([]BulkResult, len(items))
+	pending := make([]int, len(items))
+	for n := range items {
+		pending[n] = n
+	}
+	for attempt := 1; ; attempt++ {
+		batch := make([]BulkItem, len(pending))
+		for k, n := range pending {
+			batch[k] = items[n]
+		}
+		got, err := e.bulk(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		var rejected []int
+		for k, n := range pending {
+			results[n] = got[k]
+			if got[k].Status == http.StatusTooManyRequests {
+				rejected = append(rejected, n)
+			}
+		}
+		if len(rejected) == 0 || attempt >= e.retry.MaxAttempts {
+			return results, nil
+		}
+
+		wait := e.retry.backoff(attempt, nil)
+		slog.Warn("retry bulk items",
+			slog.Int("attempt", attempt),
+			slog.Int("items", len(rejected)),
+			slog.Duration("wait", wait),
+		)
+		select {
+		case <-ctx.Done():
+			return results, ctx.Err()
+		case <-time.After(wait):
+		}
+		pending = rejected
+	}
+}
+
+func (e *ESClient) bulk(ctx context.Context, items []BulkItem) ([]BulkResult, error) {
+	var buf bytes.Buffer
+	for _, item := range items {
+		if err := item.encode(&buf); err != nil {
+			return nil, err
+		}
+	}
+	var resp struct {
+		Errors bool                    `json:"errors"`
+		Items  []map[string]BulkResult `json:"items"`
+	}
+	req := esapi.BulkRequest{Body: bytes.NewReader(buf.Bytes())}
+	do := e.doInto
+	if slices.ContainsFunc(items, func(item BulkItem) bool { return item.ID == "" }) {
+		// resending would index those items twice under new IDs
+		do = func(ctx context.Context, req esapi.Request, out any) error {
+			return doRequest(ctx, e.client, req, out, e.exactNumbers)
+		}
+	}
+	if err := do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Items) != len(items) {
+		return nil, DecodeErr(fmt.Errorf("bulk answered %v items for %v", len(resp.Items), len(items)))
+	}
+	results := make([]BulkResult, len(items))
+	for n, item := range resp.Items {
+		for _, result := range item {
+			results[n] = result
+		}
+	}
+	return results, nil
+}
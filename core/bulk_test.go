@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/internal/estest"
+)
+
+func Test_ESClient_Bulk(t *testing.T) {
+	sent := make(map[string]int)
+	cli := newMockClient(t, estest.BulkHandler(t, func(item estest.BulkItem) estest.BulkResult {
+		sent[item.ID]++
+		switch {
+		case item.ID == "2" && sent[item.ID] == 1:
+			return estest.BulkResult{Status: 429, Type: "es_rejected_execution_exception", Reason: "busy"}
+		case item.ID == "3":
+			return estest.BulkResult{Status: 400, Type: "mapper_parsing_exception", Reason: "bad"}
+		}
+		return estest.BulkResult{}
+	}))
+	cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	items := []BulkItem{
+		{Index: "idx", ID: "1", Source: json.RawMessage(`{"a":1}`)},
+		{Index: "idx", ID: "2", Source: json.RawMessage(`{"a":2}`)},
+		{Index: "idx", ID: "3", Source: json.RawMessage(`{"a":"x"}`)},
+	}
+	results, err := cli.Bulk(context.TODO(), items)
+	if err != nil {
+		t.Fatalf("Bulk() error = %v", err)
+	}
+	if want := map[string]int{"1": 1, "2": 2, "3": 1}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent = %v, want %v", sent, want)
+	}
+	for n, want := range []bool{false, false, true} {
+		if results[n].Failed() != want {
+			t.Errorf("result %v = %+v, want failed %v", n, results[n], want)
+		}
+	}
+	if results[2].Error == nil || results[2].Error.Type != "mapper_parsing_exception" {
+		t.Errorf("result 2 error = %+v", results[2].Error)
+	}
+}
+
+func Test_ESClient_Bulk_NoResendWithoutID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want int
+	}{
+		{"with id", "1", 3},
+		{"without id", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+			items := []BulkItem{{Index: "idx", ID: tt.id, Source: json.RawMessage(`{"a":1}`)}}
+			if _, err := cli.Bulk(context.TODO(), items); err == nil {
+				t.Fatalf("Bulk() error = nil, want the 503")
+			}
+			if requests != tt.want {
+				t.Errorf("Bulk() sent %v requests, want %v", requests, tt.want)
+			}
+		})
+	}
+}
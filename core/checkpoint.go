@@ -0,0 +1,65 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Checkpoint records how far a dump got, so that it can be resumed after the
+// last hit which reached the output.
+type Checkpoint struct {
+	Start       time.Time         `json:"start"` // remaining window of the dump
+	End         time.Time         `json:"end"`
+	SearchAfter []json.RawMessage `json:"search_after,omitempty"`
+	TieBreaker  string            `json:"tie_breaker,omitempty"` // of SearchAfter, if stable across points in time
+	Rows        int64             `json:"rows"`
+	Offset      int64             `json:"offset"` // output file offset
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Advance moves the checkpoint past the last hit of a written batch of query.
+func (c *Checkpoint) Advance(query *QueryConfig, last Hit, rows int) {
+	c.Rows += int64(rows)
+	c.SearchAfter = last.Sort
+	c.TieBreaker = ""
+	if query.UsePointInTime() && query.tieBreaker != "_shard_doc" {
+		// _shard_doc values only make sense within the point in time they
+		// come from, which is gone when the dump resumes
+		c.TieBreaker = query.tieBreaker
+	}
+	if t, err := query.HitTime(last); err == nil {
+		c.Start = t
+	}
+	c.UpdatedAt = time.Now()
+}
+
+// Save writes the checkpoint to path atomically.
+func (c *Checkpoint) Save(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return MarshalErr(err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCheckpoint reads the checkpoint at path. It returns nil without error
+// when there is no checkpoint yet.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, UnmarshalErr(err)
+	}
+	return &c, nil
+}
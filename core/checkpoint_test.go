@@ -0,0 +1,30 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_Checkpoint_Advance(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping TimeMapping
+		sort    string
+	}{
+		{"date", TimeMapping{Type: "date"}, "1730941200000"},
+		{"epoch second", TimeMapping{Type: "long", Format: "epoch_second"}, "1730941200"},
+		{"date nanos", TimeMapping{Type: "date_nanos"}, "1730941200000000000"},
+	}
+	want := testStart.Add(time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := newTestQuery(t, WithTimeMapping(tt.mapping))
+			cp := &Checkpoint{Start: testStart, End: testEnd}
+			cp.Advance(query, Hit{ID: "1", Sort: []json.RawMessage{json.RawMessage(tt.sort)}}, 1)
+			if !cp.Start.Equal(want) || cp.Rows != 1 {
+				t.Errorf("Advance() = %v after %v rows, want %v after 1 row", cp.Start, cp.Rows, want)
+			}
+		})
+	}
+}
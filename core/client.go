@@ -1,9 +1,12 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"time"
 
@@ -13,7 +16,9 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-func doRequest(ctx context.Context, cli *elasticsearch.Client, req esapi.Request) (*ESResponse, error) {
+// doRequest sends req and decodes a successful response into out, keeping
+// its numbers as json.Number if exactNumbers.
+func doRequest(ctx context.Context, cli *elasticsearch.Client, req esapi.Request, out any, exactNumbers bool) error {
 	res, err := req.Do(ctx, cli)
 	defer func() {
 		if res != nil && res.Body != nil {
@@ -21,97 +26,173 @@ func doRequest(ctx context.Context, cli *elasticsearch.Client, req esapi.Request
 		}
 	}()
 	if err != nil {
-		return nil, ESRequestErr(err)
+		return ESRequestErr(err)
 	}
 	if res.IsError() {
-		errorInfo := make(map[string]interface{})
-		if err = json.NewDecoder(res.Body).Decode(&errorInfo); err != nil {
-			return nil, DecodeErr(err)
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return ESRequestErr(err)
 		}
-		if b, err := json.Marshal(errorInfo); err == nil {
-			return nil, ESResponseErr(nil, res.StatusCode, string(b))
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, body); err == nil {
+			body = compact.Bytes()
 		}
-		return nil, ESResponseErr(nil, res.StatusCode, fmt.Sprintf("%+v", errorInfo))
+		respErr := ESResponseErr(nil, res.StatusCode, string(body))
+		respErr.retryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		return respErr
+	}
+	dec := json.NewDecoder(res.Body)
+	if exactNumbers {
+		dec.UseNumber()
 	}
-	var initResult ESResponse
-	if err = json.NewDecoder(res.Body).Decode(&initResult); err != nil {
-		return nil, DecodeErr(err)
+	if err = dec.Decode(out); err != nil {
+		return DecodeErr(err)
 	}
-	return &initResult, nil
+	return nil
 }
 
 type ESClient struct {
-	client   *elasticsearch.Client
-	chanSize int
+	client       *elasticsearch.Client
+	chanSize     int
+	retry        RetryPolicy
+	exactNumbers bool
 }
 
 func NewClient(addresses []string, username, password string, chanSize int) (*ESClient, error) {
-	client, err := elasticsearch.NewClient(elasticsearch.Config{
+	return NewClientWithConfig(ClientConfig{
 		Addresses: addresses,
 		Username:  username,
 		Password:  password,
+		ChanSize:  chanSize,
 	})
+}
+
+// WithRetryPolicy returns a copy of the client retrying with policy, the
+// client itself left as is.
+func (e *ESClient) WithRetryPolicy(policy RetryPolicy) *ESClient {
+	c := *e
+	c.retry = policy
+	return &c
+}
+
+// SetExactNumbers sets whether the numbers of the hits are decoded as
+// json.Number, see ClientConfig.ExactNumbers.
+func (e *ESClient) SetExactNumbers(exact bool) *ESClient {
+	e.exactNumbers = exact
+	return e
+}
+
+// withExactNumbers returns a copy of the client decoding numbers as
+// json.Number, for the aggregations whose keys and values are written out.
+func (e *ESClient) withExactNumbers() *ESClient {
+	exact := *e
+	exact.exactNumbers = true
+	return &exact
+}
+
+// SetRetryPolicy sets how requests failing on retryable errors are retried.
+func (e *ESClient) SetRetryPolicy(policy RetryPolicy) *ESClient {
+	e.retry = policy
+	return e
+}
+
+// Count returns the number of hits of the query. The count API only takes the
+// query, so a query over runtime fields is counted by a search instead.
+func (e *ESClient) Count(ctx context.Context, query *QueryConfig) (int64, error) {
+	if len(query.body.RuntimeMappings) > 0 {
+		return e.countBySearch(ctx, query)
+	}
+	bodyReader, err := marshalBytesBreader(M{"query": query.body.Query})
 	if err != nil {
-		return nil, ESClientCreateErr(err)
+		return 0, err
 	}
-	if _, err := client.Ping(); err != nil {
-		return nil, ESConnectErr(err)
+	req := esapi.CountRequest{
+		Index:             query.index,
+		Body:              bodyReader,
+		IgnoreUnavailable: query.ignoreUnavailable,
+		AllowNoIndices:    query.allowNoIndices,
+		ExpandWildcards:   query.expandWildcards,
 	}
-	ins := &ESClient{
-		client:   client,
-		chanSize: chanSize,
+	resp, err := e.do(ctx, req)
+	if err != nil {
+		return 0, err
 	}
-	return ins, nil
+	return resp.Count, nil
 }
 
-func (e *ESClient) Count(ctx context.Context, query *QueryConfig) (int64, error) {
-	req := esapi.CountRequest{
-		Index: query.index,
-		Body:  query.bodyReader,
+func (e *ESClient) countBySearch(ctx context.Context, query *QueryConfig) (int64, error) {
+	bodyReader, err := marshalBytesBreader(M{
+		"query":            query.body.Query,
+		"runtime_mappings": query.body.RuntimeMappings,
+		"size":             0,
+		"track_total_hits": true,
+	})
+	if err != nil {
+		return 0, err
 	}
-	resp, err := doRequest(ctx, e.client, req)
+	resp, err := e.do(ctx, query.searchRequest(bodyReader))
 	if err != nil {
 		return 0, err
 	}
-	return resp.Count, nil
+	return int64(resp.Hits.Total.Value), nil
 }
 
 func (e *ESClient) ScrollWithConsume(ctx context.Context, query *QueryConfig, consumeFn ConsumeFunc) error {
 	c := make(chan Hit, e.chanSize)
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error { consumeFn(c); return nil })
-	g.Go(func() error { defer close(c); return e.scroll(ctx, c, query) })
+	g.Go(func() error { defer close(c); return e.scrollSlices(ctx, c, query) })
 	return g.Wait()
 }
 
-func (e *ESClient) scroll(ctx context.Context, c chan Hit, query *QueryConfig) error {
+// scrollSlices drives one scroll cursor per slice, all of them feeding c.
+func (e *ESClient) scrollSlices(ctx context.Context, c chan Hit, query *QueryConfig) error {
+	if query.slices <= 1 {
+		return e.scroll(ctx, c, query, nil)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for id := range query.slices {
+		g.Go(func() error {
+			return e.scroll(ctx, c, query, &ESBodySlice{ID: id, Max: query.slices})
+		})
+	}
+	return g.Wait()
+}
+
+func (e *ESClient) scroll(ctx context.Context, c chan Hit, query *QueryConfig, slice *ESBodySlice) error {
 	select {
 	case <-ctx.Done():
 		return nil
 	default:
-		req := esapi.SearchRequest{
-			Index:  query.index,
-			Body:   query.bodyReader,
-			Scroll: query.scroll,
-			Size:   &query.batchSize,
+		body, err := query.UpdateBodySlice(slice)
+		if err != nil {
+			return err
 		}
-		initResult, err := doRequest(ctx, e.client, req)
+		bodyReader, err := marshalBytesBreader(body)
+		if err != nil {
+			return err
+		}
+		req := query.searchRequest(bodyReader)
+		req.Scroll = query.scroll
+		req.Size = &query.batchSize
+		initResult, err := e.search(ctx, query, req)
 		if err != nil {
 			return err
 		}
 		for _, v := range initResult.Hits.Hits {
 			c <- v
 		}
-		return e.loopData(ctx, c, initResult.ScrollID)
+		return e.loopData(ctx, c, query, initResult.ScrollID)
 	}
 }
 
-func (e *ESClient) loopData(ctx context.Context, c chan Hit, scrollId string) (err error) {
+func (e *ESClient) loopData(ctx context.Context, c chan Hit, query *QueryConfig, scrollId string) (err error) {
 	if scrollId == "" {
 		return nil
 	}
 	defer func() {
-		err = e.clearScroll(ctx, scrollId)
+		// clear even if ctx is canceled, otherwise the cursor lives until it expires
+		err = errors.Join(err, e.clearScroll(context.WithoutCancel(ctx), scrollId))
 	}()
 
 	for {
@@ -119,8 +200,8 @@ func (e *ESClient) loopData(ctx context.Context, c chan Hit, scrollId string) (e
 		case <-ctx.Done():
 			return nil
 		default:
-			req := esapi.ScrollRequest{ScrollID: scrollId, Scroll: time.Minute * 3}
-			result, err := doRequest(ctx, e.client, req)
+			req := esapi.ScrollRequest{ScrollID: scrollId, Scroll: query.scroll}
+			result, err := e.search(ctx, query, req)
 			if err != nil {
 				return err
 			}
@@ -132,7 +213,7 @@ func (e *ESClient) loopData(ctx context.Context, c chan Hit, scrollId string) (e
 				c <- v
 			}
 			scrollId = result.ScrollID
-			time.Sleep(time.Second) // don't be too fast
+			time.Sleep(query.scrollInterval) // don't be too fast
 			// log.Printf("scrolling %v...", scrollId)
 		}
 	}
@@ -143,7 +224,7 @@ func (e *ESClient) clearScroll(ctx context.Context, scrollId string) error {
 		return nil
 	}
 	req := esapi.ClearScrollRequest{ScrollID: []string{scrollId}}
-	_, err := doRequest(ctx, e.client, req)
+	_, err := e.do(ctx, req)
 	return err
 }
 
@@ -151,15 +232,53 @@ func (e *ESClient) FindWithConsume(ctx context.Context, query *QueryConfig, cons
 	c := make(chan Hit, e.chanSize)
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error { consumeFn(c); return nil })
-	g.Go(func() error { defer close(c); return e.findWithConsume(ctx, c, query) })
+	g.Go(func() error {
+		defer close(c)
+		if query.UsePointInTime() {
+			return e.findWithPIT(ctx, c, query)
+		}
+		return e.findWithConsume(ctx, c, query)
+	})
 	return g.Wait()
 }
 
-func (e *ESClient) findWithConsume(ctx context.Context, c chan Hit, query *QueryConfig) error {
+func (e *ESClient) findWithPIT(ctx context.Context, c chan Hit, query *QueryConfig) (err error) {
+	pitID, err := openPointInTime(ctx, e, query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, closePointInTime(context.WithoutCancel(ctx), e, pitID))
+	}()
 
-	sTime := query.startTime
-	eTime := query.startTime.Add(query.stepDuration)
-	for sTime.Compare(eTime) < 0 {
+	var after []json.RawMessage
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			resp, err := searchAfter(ctx, e, query, pitID, after, query.startTime, query.endTime)
+			if err != nil {
+				return err
+			}
+			if resp.PitID != "" {
+				pitID = resp.PitID
+			}
+			hits := resp.Hits.Hits
+			for _, v := range hits {
+				c <- v
+			}
+			if len(hits) < query.batchSize {
+				return nil
+			}
+			after = hits[len(hits)-1].Sort
+		}
+	}
+}
+
+func (e *ESClient) findWithConsume(ctx context.Context, c chan Hit, query *QueryConfig) error {
+	sTime, eTime := query.firstWindow(query.startTime, query.endTime)
+	for sTime.Before(eTime) {
 		body, err := query.UpdateBodyTimeRange(sTime, eTime)
 		if err != nil {
 			return err
@@ -169,11 +288,9 @@ func (e *ESClient) findWithConsume(ctx context.Context, c chan Hit, query *Query
 			return err
 		}
 		slog.Info(fmt.Sprintf("querying %v ~ %v...", sTime, eTime))
-		resp, err := doRequest(ctx, e.client, esapi.SearchRequest{
-			Index: query.index,
-			Body:  bodyReader,
-			Size:  &query.body.Size,
-		})
+		req := query.searchRequest(bodyReader)
+		req.Size = query.pageSize()
+		resp, err := e.search(ctx, query, req)
 		if err != nil {
 			return err
 		}
@@ -181,19 +298,9 @@ func (e *ESClient) findWithConsume(ctx context.Context, c chan Hit, query *Query
 		for _, v := range hits.Hits {
 			c <- v
 		}
-
-		if hits.Total.Value >= 10000 && hits.Total.Relation == "gte" {
-			maxTime := hits.Hits[len(hits.Hits)-1].Source[query.timeField].(string)
-			maxTimeT, err := time.Parse(ESDateFormat, maxTime)
-			if err != nil {
-				return err
-			}
-			sTime = maxTimeT
-			// eTime don't need to change
-			continue
+		if sTime, eTime, err = query.nextWindow(sTime, eTime, hits); err != nil {
+			return err
 		}
-		sTime = eTime
-		eTime = time.Unix(min(sTime.Add(query.stepDuration).Unix(), query.endTime.Unix()), 0)
 	}
 	return nil
 }
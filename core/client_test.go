@@ -2,8 +2,15 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 )
 
 func Test_NewClient(t *testing.T) {
@@ -61,3 +68,69 @@ func Test_ESClient_Scroll(t *testing.T) {
 		t.Errorf("ESClient.FindWithConsume() error = %v", err)
 	}
 }
+
+func Test_ESClient_Count(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime M
+		path    string
+		keys    []string
+	}{
+		{"count api", nil, "/idx/_count", []string{"query"}},
+		{"runtime fields", M{"day": M{"type": "keyword"}}, "/idx/_search",
+			[]string{"query", "runtime_mappings", "size", "track_total_hits"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("Count() requested %v, want %v", r.URL.Path, tt.path)
+				}
+				var body M
+				json.NewDecoder(r.Body).Decode(&body)
+				keys := slices.Sorted(maps.Keys(body))
+				if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+					t.Errorf("Count() sent body keys %v, want %v", keys, tt.keys)
+				}
+				w.Write([]byte(`{"count":42,"hits":{"total":{"value":42,"relation":"eq"}}}`))
+			})
+			query := newTestQuery(t, WithBody(&ESBody{
+				Source:          &ESBodySource{Includes: []string{"a"}},
+				Fields:          []any{"day"},
+				RuntimeMappings: tt.runtime,
+			}), WithSize(10))
+			count, err := cli.Count(context.TODO(), query)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if count != 42 {
+				t.Errorf("Count() = %v, want 42", count)
+			}
+		})
+	}
+}
+
+func Test_ESClient_ExactNumbers(t *testing.T) {
+	tests := []struct {
+		exact bool
+		want  any
+	}{
+		{false, float64(42)},
+		{true, json.Number("42")},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("exact ", tt.exact), func(t *testing.T) {
+			cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"hits":{"hits":[{"_id":"1","_source":{"n":42}}]}}`))
+			})
+			cli.SetExactNumbers(tt.exact)
+			resp, err := cli.do(context.TODO(), esapi.SearchRequest{Index: []string{"idx"}})
+			if err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			if got := resp.Hits.Hits[0].Source["n"]; got != tt.want {
+				t.Errorf("source n = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TCP404/eutil"
+	"golang.org/x/sync/errgroup"
+)
+
+// CompositeAgg is a composite aggregation dumped bucket by bucket.
+type CompositeAgg struct {
+	// Sources are the bucket keys, each {"name": {"terms": {...}}} or another
+	// composite source. Their order is the column order.
+	Sources []M
+	// Aggs are the metric sub-aggregations computed per bucket.
+	Aggs M
+	// Size is the number of buckets per page, 1000 if 0.
+	Size int
+}
+
+// Bucket is one composite bucket flattened into a row: its keys, its doc
+// count and its metrics.
+type Bucket struct {
+	Key      M
+	DocCount int64
+	Metrics  M
+	header   []string
+}
+
+func (b Bucket) GetHeader() []string {
+	return b.header
+}
+
+func (b Bucket) GetValue() M {
+	value := make(M, len(b.Key)+len(b.Metrics)+1)
+	for k, v := range b.Key {
+		value[k] = v
+	}
+	value["doc_count"] = b.DocCount
+	for k, v := range b.Metrics {
+		value[k] = v
+	}
+	return value
+}
+
+// singleValueMetrics are the metric aggregations flattened into one column.
+var singleValueMetrics = []string{
+	"avg", "sum", "min", "max", "value_count", "cardinality",
+	"median_absolute_deviation", "weighted_avg", "rate", "scripted_metric",
+}
+
+// Header returns the columns of the buckets of the aggregation in the order
+// flattenBucket writes them, or nil when the columns of a sub-aggregation are
+// only known from its response.
+func (a CompositeAgg) Header() []string {
+	header := make([]string, 0, len(a.Sources)+len(a.Aggs)+1)
+	for _, s := range a.Sources {
+		for name := range s {
+			header = append(header, name)
+		}
+	}
+	header = append(header, "doc_count")
+
+	names := make([]string, 0, len(a.Aggs))
+	for name := range a.Aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var def map[string]json.RawMessage
+		b, _ := json.Marshal(a.Aggs[name])
+		json.Unmarshal(b, &def)
+		var cols []string
+		for typ, opts := range def {
+			switch {
+			case slices.Contains(singleValueMetrics, typ):
+				cols = []string{name}
+			case typ == "stats":
+				cols = prefixed(name, "avg", "count", "max", "min", "sum")
+			case typ == "percentiles":
+				cols = percentileCols(name, opts)
+			}
+		}
+		if cols == nil {
+			return nil
+		}
+		header = append(header, cols...)
+	}
+	return header
+}
+
+func prefixed(name string, keys ...string) []string {
+	cols := make([]string, len(keys))
+	for n, k := range keys {
+		cols[n] = name + "." + k
+	}
+	return cols
+}
+
+// percentileCols names the percentiles like ES keys them, e.g. 95.0, in the
+// string order flattenMetric sorts them in.
+func percentileCols(name string, opts json.RawMessage) []string {
+	o := struct {
+		Percents []float64 `json:"percents"`
+		Keyed    *bool     `json:"keyed"`
+	}{Percents: []float64{1, 5, 25, 50, 75, 95, 99}}
+	if err := json.Unmarshal(opts, &o); err != nil || (o.Keyed != nil && !*o.Keyed) {
+		return nil
+	}
+	keys := make([]string, 0, len(o.Percents))
+	for _, p := range o.Percents {
+		key := strconv.FormatFloat(p, 'f', -1, 64)
+		if !strings.Contains(key, ".") {
+			key += ".0"
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return prefixed(name, keys...)
+}
+
+// CompositeWithConsume pages through the composite aggregation over the hits
+// of the query with after_key and hands its buckets to consumeFn.
+func (e *ESClient) CompositeWithConsume(ctx context.Context, query *QueryConfig, agg CompositeAgg, consumeFn func(chan Bucket)) error {
+	c := make(chan Bucket, e.chanSize)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { consumeFn(c); return nil })
+	g.Go(func() error { defer close(c); return e.composite(ctx, c, query, agg) })
+	return g.Wait()
+}
+
+func (e *ESClient) composite(ctx context.Context, c chan Bucket, query *QueryConfig, agg CompositeAgg) error {
+	if agg.Size == 0 {
+		agg.Size = 1000
+	}
+	keys := make([]string, 0, len(agg.Sources))
+	for _, s := range agg.Sources {
+		for name := range s {
+			keys = append(keys, name)
+		}
+	}
+
+	var after M
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		body := new(ESBody)
+		if err := eutil.DeepCopy(*query.body, body); err != nil {
+			return err
+		}
+		composite := M{"size": agg.Size, "sources": agg.Sources}
+		if after != nil {
+			composite["after"] = after
+		}
+		body.Aggs = M{"composite": M{"composite": composite}}
+		if len(agg.Aggs) > 0 {
+			body.Aggs["composite"].(M)["aggs"] = agg.Aggs
+		}
+		bodyReader, err := marshalBytesBreader(body)
+		if err != nil {
+			return err
+		}
+		size := 0
+		req := query.searchRequest(bodyReader)
+		req.Size = &size
+		resp, err := e.withExactNumbers().search(ctx, query, req)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(resp.Aggregations["composite"])
+		if err != nil {
+			return MarshalErr(err)
+		}
+		var page struct {
+			AfterKey M                 `json:"after_key"`
+			Buckets  []json.RawMessage `json:"buckets"`
+		}
+		if err := unmarshalNumber(b, &page); err != nil {
+			return DecodeErr(err)
+		}
+		for _, raw := range page.Buckets {
+			bucket, err := flattenBucket(raw, keys)
+			if err != nil {
+				return err
+			}
+			c <- bucket
+		}
+		slog.Debug("composite page", slog.Int("buckets", len(page.Buckets)), slog.Any("after", page.AfterKey))
+		if len(page.Buckets) == 0 || page.AfterKey == nil {
+			return nil
+		}
+		after = page.AfterKey
+	}
+}
+
+// flattenBucket turns a composite bucket into a row. Single value metrics
+// become one column, multi value metrics one column per value named
+// metric.value, and anything else is kept as JSON.
+func flattenBucket(raw json.RawMessage, keys []string) (Bucket, error) {
+	var fields map[string]json.RawMessage
+	if err := unmarshalNumber(raw, &fields); err != nil {
+		return Bucket{}, DecodeErr(err)
+	}
+	bucket := Bucket{Metrics: M{}}
+	if err := unmarshalNumber(fields["key"], &bucket.Key); err != nil {
+		return Bucket{}, DecodeErr(err)
+	}
+	if err := unmarshalNumber(fields["doc_count"], &bucket.DocCount); err != nil {
+		return Bucket{}, DecodeErr(err)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if name != "key" && name != "doc_count" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var metricCols []string
+	for _, name := range names {
+		var metric M
+		if err := unmarshalNumber(fields[name], &metric); err != nil {
+			return Bucket{}, DecodeErr(err)
+		}
+		metricCols = append(metricCols, flattenMetric(name, metric, bucket.Metrics)...)
+	}
+	bucket.header = append(append(append([]string{}, keys...), "doc_count"), metricCols...)
+	return bucket, nil
+}
+
+func flattenMetric(name string, metric M, into M) []string {
+	if s, ok := metric["value_as_string"]; ok {
+		into[name] = s
+		return []string{name}
+	}
+	if v, ok := metric["value"]; ok {
+		into[name] = v
+		return []string{name}
+	}
+	if values, ok := metric["values"].(map[string]any); ok {
+		metric = values
+	}
+	var cols []string
+	keys := make([]string, 0, len(metric))
+	for k := range metric {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch v := metric[k].(type) {
+		case map[string]any, []any:
+			if k == "meta" {
+				continue
+			}
+			b, _ := json.Marshal(v)
+			into[name+"."+k] = string(b)
+		default:
+			into[name+"."+k] = v
+		}
+		cols = append(cols, name+"."+k)
+	}
+	return cols
+}
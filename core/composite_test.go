@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ESClient_CompositeWithConsume(t *testing.T) {
+	pages := []string{
+		`{"aggregations":{"composite":{"after_key":{"host":"b","day":1730937600000},"buckets":[
+			{"key":{"host":"a","day":1730937600000},"doc_count":3,"bytes":{"value":30},"latency":{"count":3,"min":1,"max":5,"avg":3,"sum":9}},
+			{"key":{"host":"b","day":1730937600000},"doc_count":1,"bytes":{"value":null},"latency":{"count":0,"min":null,"max":null,"avg":null,"sum":0}}]}}}`,
+		`{"aggregations":{"composite":{"after_key":{"host":"c","day":1730937600000},"buckets":[
+			{"key":{"host":"c","day":1730937600000},"doc_count":2,"bytes":{"value":7},"latency":{"count":2,"min":2,"max":2,"avg":2,"sum":4}}]}}}`,
+		`{"aggregations":{"composite":{"buckets":[]}}}`,
+	}
+	var n int
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Aggs struct {
+				Composite struct {
+					Composite struct {
+						After M `json:"after"`
+					} `json:"composite"`
+				} `json:"composite"`
+			} `json:"aggs"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if after := body.Aggs.Composite.Composite.After; (n == 0) != (after == nil) {
+			t.Errorf("page %v after = %v", n, after)
+		}
+		if r.URL.Query().Get("size") != "0" {
+			t.Errorf("search size = %v, want 0", r.URL.Query().Get("size"))
+		}
+		w.Write([]byte(pages[n]))
+		n++
+	})
+	query := newTestQuery(t)
+	agg := CompositeAgg{
+		Sources: []M{
+			{"host": M{"terms": M{"field": "host"}}},
+			{"day": M{"date_histogram": M{"field": "ts", "calendar_interval": "1d"}}},
+		},
+		Aggs: M{"bytes": M{"sum": M{"field": "bytes"}}, "latency": M{"stats": M{"field": "latency"}}},
+		Size: 2,
+	}
+
+	var buckets []Bucket
+	err := cli.CompositeWithConsume(context.TODO(), query, agg, func(c chan Bucket) {
+		for b := range c {
+			buckets = append(buckets, b)
+		}
+	})
+	if err != nil {
+		t.Fatalf("CompositeWithConsume() error = %v", err)
+	}
+	if len(buckets) != 3 {
+		t.Fatalf("got %v buckets, want 3", len(buckets))
+	}
+	wantHeader := []string{"host", "day", "doc_count", "bytes", "latency.avg", "latency.count", "latency.max", "latency.min", "latency.sum"}
+	if got := buckets[0].GetHeader(); !reflect.DeepEqual(got, wantHeader) {
+		t.Errorf("GetHeader() = %v, want %v", got, wantHeader)
+	}
+	if got := agg.Header(); !reflect.DeepEqual(got, wantHeader) {
+		t.Errorf("Header() = %v, want %v", got, wantHeader)
+	}
+	row := buckets[0].GetValue()
+	if row["host"] != "a" || row["doc_count"] != int64(3) || row["bytes"] != json.Number("30") || row["latency.avg"] != json.Number("3") {
+		t.Errorf("GetValue() = %v", row)
+	}
+}
+
+func Test_ESClient_CompositeWithConsume_ExactNumbers(t *testing.T) {
+	const id = "9007199254740993" // not a float64
+	var n int
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if n == 1 && !strings.Contains(string(body), `"after":{"id":`+id+`}`) {
+			t.Errorf("second page body = %s, want the exact after_key", body)
+		}
+		if n == 0 {
+			fmt.Fprintf(w, `{"aggregations":{"composite":{"after_key":{"id":%v},"buckets":[{"key":{"id":%v},"doc_count":1,"max":{"value":%v}}]}}}`, id, id, id)
+		} else {
+			w.Write([]byte(`{"aggregations":{"composite":{"buckets":[]}}}`))
+		}
+		n++
+	})
+	agg := CompositeAgg{
+		Sources: []M{{"id": M{"terms": M{"field": "id"}}}},
+		Aggs:    M{"max": M{"max": M{"field": "id"}}},
+	}
+	var buckets []Bucket
+	err := cli.CompositeWithConsume(context.TODO(), newTestQuery(t), agg, func(c chan Bucket) {
+		for b := range c {
+			buckets = append(buckets, b)
+		}
+	})
+	if err != nil {
+		t.Fatalf("CompositeWithConsume() error = %v", err)
+	}
+	if len(buckets) != 1 {
+		t.Fatalf("got %v buckets, want 1", len(buckets))
+	}
+	if row := buckets[0].GetValue(); row["id"] != json.Number(id) || row["max"] != json.Number(id) {
+		t.Errorf("GetValue() = %v, want id and max %v", row, id)
+	}
+}
+
+func Test_CompositeAgg_Header(t *testing.T) {
+	sources := []M{{"host": M{"terms": M{"field": "host"}}}}
+	tests := []struct {
+		name string
+		aggs M
+		want []string
+	}{
+		{"no metrics", nil, []string{"host", "doc_count"}},
+		{
+			"percentiles",
+			M{"p": M{"percentiles": M{"field": "latency", "percents": []float64{50, 99.9}}}, "n": M{"cardinality": M{"field": "user"}}},
+			[]string{"host", "doc_count", "n", "p.50.0", "p.99.9"},
+		},
+		{
+			"default percents",
+			M{"p": M{"percentiles": M{"field": "latency"}}},
+			[]string{"host", "doc_count", "p.1.0", "p.25.0", "p.5.0", "p.50.0", "p.75.0", "p.95.0", "p.99.0"},
+		},
+		{"unknown columns", M{"top": M{"top_hits": M{"size": 1}}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompositeAgg{Sources: sources, Aggs: tt.aggs}.Header()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Header() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// ClientConfig holds everything needed to connect to a cluster. Only one of
+// the credentials is used: APIKey, then BearerToken, then Username/Password.
+type ClientConfig struct {
+	Addresses []string
+	CloudID   string
+
+	Username    string
+	Password    string
+	APIKey      string // base64 encoded "id:api_key"
+	BearerToken string // service account token or any other bearer token
+
+	CACert             []byte // PEM encoded, appended to CACertFile if both are set
+	CACertFile         string
+	ClientCertFile     string
+	ClientKeyFile      string
+	InsecureSkipVerify bool
+
+	Header   http.Header
+	ProxyURL string
+
+	ChanSize int
+
+	// ExactNumbers decodes the numbers of the hits as json.Number instead of
+	// float64, so that longs beyond 2^53 reach the outputers unchanged.
+	// Transform functions then see json.Number values.
+	ExactNumbers bool
+}
+
+func NewClientWithConfig(conf ClientConfig) (*ESClient, error) {
+	transport, err := conf.transport()
+	if err != nil {
+		return nil, ESClientCreateErr(err)
+	}
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:    conf.Addresses,
+		CloudID:      conf.CloudID,
+		Username:     conf.Username,
+		Password:     conf.Password,
+		APIKey:       conf.APIKey,
+		ServiceToken: conf.BearerToken,
+		Header:       conf.Header,
+		Transport:    transport,
+		DisableRetry: true, // retried by doInto, see RetryPolicy
+	})
+	if err != nil {
+		return nil, ESClientCreateErr(err)
+	}
+	if _, err := client.Ping(); err != nil {
+		return nil, ESConnectErr(err)
+	}
+	ins := &ESClient{
+		client:       client,
+		chanSize:     conf.ChanSize,
+		retry:        DefaultRetryPolicy,
+		exactNumbers: conf.ExactNumbers,
+	}
+	return ins, nil
+}
+
+func (conf ClientConfig) transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+
+	if conf.CACertFile != "" || len(conf.CACert) > 0 {
+		pem := conf.CACert
+		if conf.CACertFile != "" {
+			b, err := os.ReadFile(conf.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			pem = append(b, pem...)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no valid CA certificate found")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if conf.ClientCertFile != "" || conf.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.ClientCertFile, conf.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if conf.ProxyURL != "" {
+		proxy, err := url.Parse(conf.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport, nil
+}
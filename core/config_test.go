@@ -0,0 +1,155 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTLSCluster(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_NewClientWithConfig_TLS(t *testing.T) {
+	srv := newTLSCluster(t, func(r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "APIKey a2V5OnNlY3JldA==" {
+			t.Errorf("Authorization = %q, want the api key", got)
+		}
+		if got := r.Header.Get("X-Team"); got != "dump" {
+			t.Errorf("X-Team = %q, want dump", got)
+		}
+	})
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	_, err := NewClientWithConfig(ClientConfig{
+		Addresses: []string{srv.URL},
+		APIKey:    "a2V5OnNlY3JldA==",
+		CACert:    ca,
+		Header:    http.Header{"X-Team": []string{"dump"}},
+	})
+	if err != nil {
+		t.Errorf("NewClientWithConfig() error = %v", err)
+	}
+}
+
+func Test_NewClientWithConfig_BearerToken(t *testing.T) {
+	srv := newTLSCluster(t, func(r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want the bearer token", got)
+		}
+	})
+	_, err := NewClientWithConfig(ClientConfig{
+		Addresses:          []string{srv.URL},
+		BearerToken:        "token",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Errorf("NewClientWithConfig() error = %v", err)
+	}
+}
+
+func Test_NewClientWithConfig_UnknownCA(t *testing.T) {
+	srv := newTLSCluster(t, func(r *http.Request) {})
+	_, err := NewClientWithConfig(ClientConfig{Addresses: []string{srv.URL}})
+	if err == nil {
+		t.Error("NewClientWithConfig() succeeded with an unknown CA")
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dump"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func Test_NewClientWithConfig_ClientCert(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "dump" {
+			t.Errorf("peer certificates = %v, want the client certificate", r.TLS.PeerCertificates)
+		}
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	certFile, keyFile := writeClientCert(t, t.TempDir())
+	_, err := NewClientWithConfig(ClientConfig{
+		Addresses:          []string{srv.URL},
+		ClientCertFile:     certFile,
+		ClientKeyFile:      keyFile,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Errorf("NewClientWithConfig() error = %v", err)
+	}
+
+	_, err = NewClientWithConfig(ClientConfig{Addresses: []string{srv.URL}, InsecureSkipVerify: true})
+	if err == nil {
+		t.Error("NewClientWithConfig() succeeded without the client certificate")
+	}
+}
+
+func Test_NewClientWithConfig_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	_, err := NewClientWithConfig(ClientConfig{
+		Addresses: []string{"http://es.invalid:9200"},
+		ProxyURL:  proxy.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	if proxied != "http://es.invalid:9200/" {
+		t.Errorf("proxy got %q, want the request to the cluster", proxied)
+	}
+}
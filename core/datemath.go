@@ -0,0 +1,181 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithStartExpr sets the start of the range as ES date math, e.g. now-1d/d or
+// 2024-11-07||+1M. It is resolved against the reference clock of WithNow.
+func WithStartExpr(expr string) OptFn {
+	return func(c *QueryConfig) {
+		c.startExpr = expr
+	}
+}
+
+// WithEndExpr sets the end of the range as ES date math, e.g. now/d.
+func WithEndExpr(expr string) OptFn {
+	return func(c *QueryConfig) {
+		c.endExpr = expr
+	}
+}
+
+// WithLast sets the range to the last d before now.
+func WithLast(d time.Duration) OptFn {
+	return func(c *QueryConfig) {
+		c.startExpr = fmt.Sprintf("now-%ds", int64(d.Seconds()))
+		c.endExpr = "now"
+	}
+}
+
+// WithNow pins the clock date math is resolved against, so a run can be
+// reproduced. It defaults to the time the query is created.
+func WithNow(now time.Time) OptFn {
+	return func(c *QueryConfig) {
+		c.now = now
+	}
+}
+
+// WithDateMathPassthrough sends the date math expressions to ES in the range
+// filter instead of their client side value, so ES resolves now itself. The
+// client side value still bounds the time windows.
+func WithDateMathPassthrough() OptFn {
+	return func(c *QueryConfig) {
+		c.dateMathPassthrough = true
+	}
+}
+
+// TimeRange returns the absolute range of the query, date math resolved.
+func (q *QueryConfig) TimeRange() (time.Time, time.Time) {
+	return q.startTime, q.endTime
+}
+
+// DateMath returns the date math expressions of the range, empty when a
+// bound was given as an absolute time.
+func (q *QueryConfig) DateMath() (string, string) {
+	return q.startExpr, q.endExpr
+}
+
+func (q *QueryConfig) resolveDateMath() error {
+	if q.now.IsZero() {
+		q.now = time.Now()
+	}
+	var err error
+	if q.startExpr != "" {
+		if q.startTime, err = ResolveDateMath(q.startExpr, q.now, q.timeZone); err != nil {
+			return err
+		}
+	}
+	if q.endExpr != "" {
+		if q.endTime, err = ResolveDateMath(q.endExpr, q.now, q.timeZone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveDateMath resolves an ES date math expression: now or an absolute date
+// followed by ||, then any number of +N<unit>, -N<unit> or /<unit>, with units
+// y, M, w, d, h, H, m and s. Rounding happens in loc, UTC if nil, and always
+// rounds down as ES does for gte and lt.
+func ResolveDateMath(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	expr = strings.TrimSpace(expr)
+	var (
+		t    time.Time
+		math string
+	)
+	if rest, ok := strings.CutPrefix(expr, "now"); ok {
+		t, math = now.In(loc), rest
+	} else {
+		anchor, rest, _ := strings.Cut(expr, "||")
+		var err error
+		if t, err = (timeFormat{}).parse(anchor, loc); err != nil {
+			return time.Time{}, errors.Wrapf(err, "date math %q", expr)
+		}
+		t, math = t.In(loc), rest
+	}
+
+	for len(math) > 0 {
+		op := math[0]
+		math = math[1:]
+		n := 1
+		if op == '+' || op == '-' {
+			digits := len(math) - len(strings.TrimLeft(math, "0123456789"))
+			if digits > 0 {
+				n, _ = strconv.Atoi(math[:digits])
+				math = math[digits:]
+			}
+			if op == '-' {
+				n = -n
+			}
+		} else if op != '/' {
+			return time.Time{}, errors.Errorf("date math %q: unexpected %q", expr, op)
+		}
+		if len(math) == 0 {
+			return time.Time{}, errors.Errorf("date math %q: missing unit", expr)
+		}
+		unit := math[0]
+		math = math[1:]
+
+		var ok bool
+		if op == '/' {
+			t, ok = roundDown(t, unit)
+		} else {
+			t, ok = addUnit(t, unit, n)
+		}
+		if !ok {
+			return time.Time{}, errors.Errorf("date math %q: unknown unit %q", expr, unit)
+		}
+	}
+	return t, nil
+}
+
+func addUnit(t time.Time, unit byte, n int) (time.Time, bool) {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0), true
+	case 'M':
+		return t.AddDate(0, n, 0), true
+	case 'w':
+		return t.AddDate(0, 0, 7*n), true
+	case 'd':
+		return t.AddDate(0, 0, n), true
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour), true
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), true
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), true
+	}
+	return t, false
+}
+
+func roundDown(t time.Time, unit byte) (time.Time, bool) {
+	y, mon, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case 'y':
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, loc), true
+	case 'M':
+		return time.Date(y, mon, 1, 0, 0, 0, 0, loc), true
+	case 'w':
+		// weeks start on monday
+		return time.Date(y, mon, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc), true
+	case 'd':
+		return time.Date(y, mon, d, 0, 0, 0, 0, loc), true
+	case 'h', 'H':
+		return time.Date(y, mon, d, t.Hour(), 0, 0, 0, loc), true
+	case 'm':
+		return time.Date(y, mon, d, t.Hour(), t.Minute(), 0, 0, loc), true
+	case 's':
+		return time.Date(y, mon, d, t.Hour(), t.Minute(), t.Second(), 0, loc), true
+	}
+	return t, false
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_ResolveDateMath(t *testing.T) {
+	now := time.Date(2024, time.November, 7, 15, 30, 45, 0, time.UTC) // a thursday
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+
+	tests := []struct {
+		expr    string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{expr: "now", want: now},
+		{expr: "now-1d/d", want: time.Date(2024, time.November, 6, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/d", want: time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "now-6h", want: now.Add(-6 * time.Hour)},
+		{expr: "now/w", want: time.Date(2024, time.November, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "now+1M/M", want: time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "2024-01-31||+1M/d", want: time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "2024-11-07T08:00:00Z", want: time.Date(2024, time.November, 7, 8, 0, 0, 0, time.UTC)},
+		{expr: "now/d", loc: shanghai, want: time.Date(2024, time.November, 6, 16, 0, 0, 0, time.UTC)},
+		{expr: "now-1x", wantErr: true},
+		{expr: "now-", wantErr: true},
+		{expr: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveDateMath(tt.expr, now, tt.loc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveDateMath(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("ResolveDateMath(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func Test_QueryConfig_DateMathPassthrough(t *testing.T) {
+	now := time.Date(2024, time.November, 7, 15, 30, 45, 0, time.UTC)
+	q := newTestQuery(t,
+		WithStartExpr("now-2d/d"),
+		WithEndExpr("now/d"),
+		WithNow(now),
+		WithStepByDay(1),
+		WithDateMathPassthrough(),
+	)
+	start, end := q.TimeRange()
+	if want := time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	if want := time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+
+	want := `{"query":{"bool":{"filter":[{"range":{"ts":{"gte":"now-2d/d","lt":"now/d"}}}]}}}`
+	if string(q.BodyBytes) != want {
+		t.Errorf("BodyBytes = %s, want %s", q.BodyBytes, want)
+	}
+	// inner window bounds stay absolute
+	sTime, eTime := q.firstWindow(start, end)
+	body, err := q.UpdateBodyTimeRange(sTime, eTime)
+	if err != nil {
+		t.Fatalf("UpdateBodyTimeRange() error = %v", err)
+	}
+	rng, _ := json.Marshal(body.Query.Bool.Filter[0]["range"].(M)["ts"])
+	if want := `{"gte":"now-2d/d","lt":"2024-11-06T00:00:00Z"}`; string(rng) != want {
+		t.Errorf("first window range = %s, want %s", rng, want)
+	}
+}
@@ -1,6 +1,17 @@
 package core
 
-import "github.com/TCP404/eutil/cerr"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/TCP404/eutil/cerr"
+)
 
 type ESClientCreateError struct {
 	*cerr.Err
@@ -20,16 +31,80 @@ func ESConnectErr(err error) ESConnectError {
 
 type ESRequestError struct {
 	*cerr.Err
+	cause error
 }
 
 func ESRequestErr(err error) ESRequestError {
-	return ESRequestError{cerr.Wrap(err, "es request error")}
+	return ESRequestError{Err: cerr.Wrap(err, "es request error"), cause: err}
+}
+
+func (e ESRequestError) Unwrap() error { return e.cause }
+
+// IsRetryable reports whether the request failed on a transient network error.
+func (e ESRequestError) IsRetryable() bool {
+	if errors.Is(e.cause, context.Canceled) || errors.Is(e.cause, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(e.cause, syscall.ECONNRESET) ||
+		errors.Is(e.cause, syscall.ECONNREFUSED) ||
+		errors.Is(e.cause, syscall.EPIPE) ||
+		errors.Is(e.cause, io.EOF) ||
+		errors.Is(e.cause, io.ErrUnexpectedEOF) ||
+		(errors.As(e.cause, &netErr) && netErr.Timeout())
+}
+
+// ESErrorType is the type of an ES error, usable as errors.Is target against
+// ESResponseError.
+type ESErrorType string
+
+func (t ESErrorType) Error() string { return string(t) }
+
+const (
+	ErrIndexNotFound        ESErrorType = "index_not_found_exception"
+	ErrSearchPhaseExecution ESErrorType = "search_phase_execution_exception"
+	ErrTooManyBuckets       ESErrorType = "too_many_buckets_exception"
+	ErrRejectedExecution    ESErrorType = "es_rejected_execution_exception"
+	ErrCircuitBreaking      ESErrorType = "circuit_breaking_exception"
+	ErrSearchContextMissing ESErrorType = "search_context_missing_exception"
+	ErrParsing              ESErrorType = "parsing_exception"
+	ErrIllegalArgument      ESErrorType = "illegal_argument_exception"
+)
+
+// ESErrorCause is the error object of an ES error response.
+type ESErrorCause struct {
+	Type         string           `json:"type"`
+	Reason       string           `json:"reason"`
+	Index        string           `json:"index,omitempty"`
+	RootCause    []ESErrorCause   `json:"root_cause,omitempty"`
+	FailedShards []ESShardFailure `json:"failed_shards,omitempty"`
+	CausedBy     *ESErrorCause    `json:"caused_by,omitempty"`
+}
+
+// UnmarshalJSON also accepts the plain string errors of some endpoints.
+func (c *ESErrorCause) UnmarshalJSON(b []byte) error {
+	var reason string
+	if err := json.Unmarshal(b, &reason); err == nil {
+		*c = ESErrorCause{Reason: reason}
+		return nil
+	}
+	type plain ESErrorCause
+	return json.Unmarshal(b, (*plain)(c))
+}
+
+type ESShardFailure struct {
+	Shard  int          `json:"shard"`
+	Index  string       `json:"index"`
+	Node   string       `json:"node"`
+	Reason ESErrorCause `json:"reason"`
 }
 
 type ESResponseError struct {
 	*cerr.Err
-	status int
-	body   string
+	status     int
+	body       string
+	cause      *ESErrorCause
+	retryAfter time.Duration
 }
 
 func ESResponseErr(err error, status int, body string) ESResponseError {
@@ -40,13 +115,162 @@ func ESResponseErr(err error, status int, body string) ESResponseError {
 		nerr = cerr.Newf("es response error. status: %v, body: %v", status, body)
 	}
 	nerr.SetCode(status)
+
+	var envelope struct {
+		Error *ESErrorCause `json:"error"`
+	}
+	json.Unmarshal([]byte(body), &envelope)
 	return ESResponseError{
 		status: status,
 		body:   body,
+		cause:  envelope.Error,
 		Err:    nerr,
 	}
 }
 
+func (e ESResponseError) Status() int  { return e.status }
+func (e ESResponseError) Body() string { return e.body }
+
+// Cause is the parsed error object of the response, nil if the body was not
+// an ES error.
+func (e ESResponseError) Cause() *ESErrorCause { return e.cause }
+
+func (e ESResponseError) Type() string {
+	if e.cause == nil {
+		return ""
+	}
+	return e.cause.Type
+}
+
+func (e ESResponseError) Reason() string {
+	if e.cause == nil {
+		return ""
+	}
+	return e.cause.Reason
+}
+
+func (e ESResponseError) RootCause() []ESErrorCause {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause.RootCause
+}
+
+func (e ESResponseError) FailedShards() []ESShardFailure {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause.FailedShards
+}
+
+// CausedBy returns the caused_by chain, outermost first.
+func (e ESResponseError) CausedBy() []ESErrorCause {
+	var chain []ESErrorCause
+	for c := e.cause; c != nil && c.CausedBy != nil; c = c.CausedBy {
+		chain = append(chain, *c.CausedBy)
+	}
+	return chain
+}
+
+// Is matches an ESErrorType found anywhere in the error: its type, root
+// causes, caused_by chain or failed shards.
+func (e ESResponseError) Is(target error) bool {
+	t, ok := target.(ESErrorType)
+	if !ok {
+		return false
+	}
+	return e.cause.hasType(string(t))
+}
+
+func (c *ESErrorCause) hasType(t string) bool {
+	if c == nil {
+		return false
+	}
+	if c.Type == t || c.CausedBy.hasType(t) {
+		return true
+	}
+	for _, root := range c.RootCause {
+		if root.hasType(t) {
+			return true
+		}
+	}
+	for _, shard := range c.FailedShards {
+		if shard.Reason.hasType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter is the wait asked by the Retry-After header, 0 if there was none.
+func (e ESResponseError) RetryAfter() time.Duration { return e.retryAfter }
+
+// IsRetryable reports whether the cluster was too busy to answer, so the same
+// request may succeed later.
+func (e ESResponseError) IsRetryable() bool {
+	switch e.status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return e.Is(ErrRejectedExecution)
+}
+
+// IsForbidden reports whether err is the cluster refusing a request the
+// credentials of the client lack the privileges for.
+func IsForbidden(err error) bool {
+	var respErr ESResponseError
+	return errors.As(err, &respErr) && respErr.status == http.StatusForbidden
+}
+
+type PartialResultsError struct {
+	*cerr.Err
+	Failures []ESShardFailure
+}
+
+func PartialResultsErr(resp *ESResponse) PartialResultsError {
+	return PartialResultsError{
+		Err: cerr.Newf("partial results. timed out: %v, failed shards: %v/%v",
+			resp.TimedOut, resp.Shards.Failed, resp.Shards.Total),
+		Failures: resp.Shards.Failures,
+	}
+}
+
+type QueryInvalidError struct {
+	*cerr.Err
+	Explanations []QueryExplanation
+}
+
+func QueryInvalidErr(reason string, explanations []QueryExplanation) QueryInvalidError {
+	if reason == "" {
+		for _, e := range explanations {
+			if !e.Valid {
+				reason = e.Error
+				break
+			}
+		}
+	}
+	return QueryInvalidError{
+		Err:          cerr.Newf("invalid query. error: %v", reason),
+		Explanations: explanations,
+	}
+}
+
+type BulkItemsError struct {
+	*cerr.Err
+	Failures []BulkResult
+}
+
+func BulkItemsErr(failures []BulkResult) BulkItemsError {
+	reason := ""
+	if len(failures) > 0 && failures[0].Error != nil {
+		reason = failures[0].Error.Type + ": " + failures[0].Error.Reason
+	}
+	return BulkItemsError{
+		Err:      cerr.Newf("%v documents rejected. first error: %v", len(failures), reason),
+		Failures: failures,
+	}
+}
+
 type DecodeError struct {
 	*cerr.Err
 }
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func Test_ESResponseErr_Structured(t *testing.T) {
+	body := `{"error":{"root_cause":[{"type":"too_many_buckets_exception","reason":"Trying to create too many buckets"}],` +
+		`"type":"search_phase_execution_exception","reason":"all shards failed","phase":"query",` +
+		`"failed_shards":[{"shard":0,"index":"idx","node":"n1","reason":{"type":"too_many_buckets_exception","reason":"Trying to create too many buckets"}}],` +
+		`"caused_by":{"type":"too_many_buckets_exception","reason":"Trying to create too many buckets"}},"status":400}`
+	err := pkgerrors.Wrap(ESResponseErr(nil, http.StatusBadRequest, body), "do request error")
+
+	var respErr ESResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("errors.As(%v) = false, want ESResponseError", err)
+	}
+	if respErr.Type() != "search_phase_execution_exception" || respErr.Reason() != "all shards failed" {
+		t.Errorf("Type(), Reason() = %v, %v", respErr.Type(), respErr.Reason())
+	}
+	if len(respErr.RootCause()) != 1 || len(respErr.FailedShards()) != 1 || len(respErr.CausedBy()) != 1 {
+		t.Errorf("RootCause(), FailedShards(), CausedBy() = %v, %v, %v", respErr.RootCause(), respErr.FailedShards(), respErr.CausedBy())
+	}
+	if respErr.FailedShards()[0].Index != "idx" {
+		t.Errorf("FailedShards()[0].Index = %v, want idx", respErr.FailedShards()[0].Index)
+	}
+	if !errors.Is(err, ErrSearchPhaseExecution) || !errors.Is(err, ErrTooManyBuckets) {
+		t.Errorf("errors.Is(%v) = false, want search phase and too many buckets", err)
+	}
+	if errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("errors.Is(%v, ErrIndexNotFound) = true, want false", err)
+	}
+}
+
+func Test_ESResponseErr_PlainError(t *testing.T) {
+	err := ESResponseErr(nil, http.StatusBadRequest, `{"error":"Incorrect HTTP method","status":405}`)
+	if err.Reason() != "Incorrect HTTP method" || err.Type() != "" {
+		t.Errorf("Type(), Reason() = %v, %v", err.Type(), err.Reason())
+	}
+}
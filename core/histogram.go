@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/TCP404/eutil"
+	"github.com/spf13/cast"
+)
+
+// Histogram is a count per time bucket report over the time range of a query.
+type Histogram struct {
+	// CalendarInterval is a calendar aware interval: 1m, 1h, 1d, 1w, 1M, 1q
+	// or 1y. It wins over FixedInterval.
+	CalendarInterval string
+	FixedInterval    time.Duration
+	// TimeZone the buckets are cut in, the one of the query if nil. Locations
+	// without an IANA name, time.Local included, are sent as their current
+	// UTC offset, so buckets across a daylight saving change are shifted; load
+	// the location by name to avoid it.
+	TimeZone *time.Location
+	// SplitField adds one column per value of the field, for its SplitSize
+	// most frequent values, 10 if 0. The other values are counted in _other.
+	// A document with several values is counted in each of them, so _other
+	// is only a lower bound for multi valued fields.
+	SplitField string
+	SplitSize  int
+}
+
+// PivotRow is one time bucket of a Histogram, with its count per split value.
+type PivotRow struct {
+	Time   time.Time
+	Total  int64
+	Counts map[string]int64
+	header []string
+}
+
+func (r PivotRow) GetHeader() []string {
+	return r.header
+}
+
+func (r PivotRow) GetValue() M {
+	value := make(M, len(r.Counts)+2)
+	value["time"] = r.Time.Format(time.RFC3339)
+	value["total"] = r.Total
+	for k, v := range r.Counts {
+		value[k] = v
+	}
+	return value
+}
+
+type histogramBucket struct {
+	Key      int64 `json:"key"`
+	DocCount int64 `json:"doc_count"`
+}
+
+// DateHistogram runs the histogram over the hits of the query and pivots it,
+// one row per time bucket, empty buckets included.
+func (e *ESClient) DateHistogram(ctx context.Context, query *QueryConfig, h Histogram) ([]PivotRow, error) {
+	loc := h.TimeZone
+	if loc == nil {
+		loc = query.timeZone
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	hist := M{
+		"field":         query.timeField,
+		"format":        "epoch_millis",
+		"time_zone":     esTimeZone(loc),
+		"min_doc_count": 0,
+		"extended_bounds": M{
+			"min": query.startTime.UnixMilli(),
+			"max": query.endTime.UnixMilli() - 1,
+		},
+	}
+	if h.CalendarInterval != "" {
+		hist["calendar_interval"] = h.CalendarInterval
+	} else if h.FixedInterval > 0 {
+		hist["fixed_interval"] = formatDuration(h.FixedInterval)
+	} else {
+		return nil, ESQueryVarifyErr("histogram interval is required")
+	}
+
+	body := new(ESBody)
+	if err := eutil.DeepCopy(*query.body, body); err != nil {
+		return nil, err
+	}
+	body.Aggs = M{"hist": M{"date_histogram": hist}}
+	if h.SplitField != "" {
+		if h.SplitSize == 0 {
+			h.SplitSize = 10
+		}
+		body.Aggs["split"] = M{
+			"terms": M{"field": h.SplitField, "size": h.SplitSize},
+			"aggs":  M{"hist": M{"date_histogram": hist}},
+		}
+	}
+	bodyReader, err := marshalBytesBreader(body)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	req := query.searchRequest(bodyReader)
+	req.Size = &size
+	resp, err := e.withExactNumbers().search(ctx, query, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(resp.Aggregations)
+	if err != nil {
+		return nil, MarshalErr(err)
+	}
+	var aggs struct {
+		Hist struct {
+			Buckets []histogramBucket `json:"buckets"`
+		} `json:"hist"`
+		Split struct {
+			Buckets []struct {
+				Key  any `json:"key"`
+				Hist struct {
+					Buckets []histogramBucket `json:"buckets"`
+				} `json:"hist"`
+			} `json:"buckets"`
+		} `json:"split"`
+	}
+	if err := unmarshalNumber(b, &aggs); err != nil {
+		return nil, DecodeErr(err)
+	}
+
+	header := []string{"time", "total"}
+	rows := make([]PivotRow, 0, len(aggs.Hist.Buckets))
+	index := make(map[int64]int, len(aggs.Hist.Buckets))
+	for n, bucket := range aggs.Hist.Buckets {
+		rows = append(rows, PivotRow{
+			Time:   time.UnixMilli(bucket.Key).In(loc),
+			Total:  bucket.DocCount,
+			Counts: make(map[string]int64),
+		})
+		index[bucket.Key] = n
+	}
+	for _, split := range aggs.Split.Buckets {
+		col := cast.ToString(split.Key)
+		header = append(header, col)
+		for _, row := range rows {
+			row.Counts[col] = 0
+		}
+		for _, bucket := range split.Hist.Buckets {
+			if n, ok := index[bucket.Key]; ok {
+				rows[n].Counts[col] = bucket.DocCount
+			}
+		}
+	}
+	if h.SplitField != "" {
+		other := false
+		for _, row := range rows {
+			var split int64
+			for _, count := range row.Counts {
+				split += count
+			}
+			row.Counts["_other"] = max(row.Total-split, 0)
+			other = other || row.Total > split
+		}
+		if other {
+			header = append(header, "_other")
+		} else {
+			for _, row := range rows {
+				delete(row.Counts, "_other")
+			}
+		}
+	}
+	for n := range rows {
+		rows[n].header = header
+	}
+	return rows, nil
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ESClient_DateHistogram(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body ESBody
+		json.NewDecoder(r.Body).Decode(&body)
+		hist := body.Aggs["hist"].(map[string]any)["date_histogram"].(map[string]any)
+		if hist["calendar_interval"] != "1h" || hist["time_zone"] != "Asia/Shanghai" {
+			t.Errorf("date_histogram = %v", hist)
+		}
+		w.Write([]byte(`{"aggregations":{
+			"hist":{"buckets":[{"key":1730937600000,"doc_count":5},{"key":1730941200000,"doc_count":0},{"key":1730944800000,"doc_count":4}]},
+			"split":{"buckets":[
+				{"key":"shoes","doc_count":6,"hist":{"buckets":[{"key":1730937600000,"doc_count":3},{"key":1730944800000,"doc_count":3}]}},
+				{"key":"hats","doc_count":2,"hist":{"buckets":[{"key":1730937600000,"doc_count":2}]}}
+			]}}}`))
+	})
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	query := newTestQuery(t,
+		WithEndTime(time.Date(2024, time.November, 7, 3, 0, 0, 0, time.UTC)),
+		WithTimeZone(shanghai),
+	)
+	rows, err := cli.DateHistogram(context.TODO(), query, Histogram{CalendarInterval: "1h", SplitField: "product"})
+	if err != nil {
+		t.Fatalf("DateHistogram() error = %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %v rows, want 3", len(rows))
+	}
+	if want := []string{"time", "total", "shoes", "hats", "_other"}; !reflect.DeepEqual(rows[0].GetHeader(), want) {
+		t.Errorf("GetHeader() = %v, want %v", rows[0].GetHeader(), want)
+	}
+	want := []M{
+		{"time": "2024-11-07T08:00:00+08:00", "total": int64(5), "shoes": int64(3), "hats": int64(2), "_other": int64(0)},
+		{"time": "2024-11-07T09:00:00+08:00", "total": int64(0), "shoes": int64(0), "hats": int64(0), "_other": int64(0)},
+		{"time": "2024-11-07T10:00:00+08:00", "total": int64(4), "shoes": int64(3), "hats": int64(0), "_other": int64(1)},
+	}
+	for n, row := range rows {
+		if got := row.GetValue(); !reflect.DeepEqual(got, want[n]) {
+			t.Errorf("row %v = %v, want %v", n, got, want[n])
+		}
+	}
+}
+
+func Test_ESClient_DateHistogram_MultiValued(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// one document tagged both shoes and hats
+		w.Write([]byte(`{"aggregations":{
+			"hist":{"buckets":[{"key":1730937600000,"doc_count":2}]},
+			"split":{"buckets":[
+				{"key":"shoes","doc_count":2,"hist":{"buckets":[{"key":1730937600000,"doc_count":2}]}},
+				{"key":"hats","doc_count":1,"hist":{"buckets":[{"key":1730937600000,"doc_count":1}]}}
+			]}}}`))
+	})
+	query := newTestQuery(t, WithEndTime(testStart.Add(time.Hour)))
+	rows, err := cli.DateHistogram(context.TODO(), query, Histogram{CalendarInterval: "1h", SplitField: "tags"})
+	if err != nil {
+		t.Fatalf("DateHistogram() error = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %v rows, want 1", len(rows))
+	}
+	if want := []string{"time", "total", "shoes", "hats"}; !reflect.DeepEqual(rows[0].GetHeader(), want) {
+		t.Errorf("GetHeader() = %v, want %v", rows[0].GetHeader(), want)
+	}
+	if other, ok := rows[0].Counts["_other"]; ok {
+		t.Errorf("_other = %v, want no _other column", other)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+type IndexInfo struct {
+	Index  string `json:"index"`
+	Status string `json:"status"`
+	Docs   int64  `json:"docs.count,string"`
+}
+
+// ResolveIndices resolves the indices, aliases, data streams and wildcards the
+// query targets to the concrete indices behind them.
+func (e *ESClient) ResolveIndices(ctx context.Context, query *QueryConfig) ([]IndexInfo, error) {
+	if query.ignoreUnavailable == nil || !*query.ignoreUnavailable {
+		return e.catIndices(ctx, query, query.index)
+	}
+	// _cat fails on the first missing target, so resolve them one by one
+	var infos []IndexInfo
+	for _, index := range query.index {
+		found, err := e.catIndices(ctx, query, []string{index})
+		if errors.Is(err, ErrIndexNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, found...)
+	}
+	return infos, nil
+}
+
+func (e *ESClient) catIndices(ctx context.Context, query *QueryConfig, index []string) ([]IndexInfo, error) {
+	var infos []IndexInfo
+	err := e.doInto(ctx, esapi.CatIndicesRequest{
+		Index:           index,
+		Format:          "json",
+		H:               []string{"index", "status", "docs.count"},
+		S:               []string{"index"},
+		ExpandWildcards: query.expandWildcards,
+	}, &infos)
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
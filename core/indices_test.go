@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func Test_ESClient_ResolveIndices(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cat/indices/logs-*":
+			if got := r.URL.Query().Get("expand_wildcards"); got != "open,hidden" {
+				t.Errorf("expand_wildcards = %q, want open,hidden", got)
+			}
+			w.Write([]byte(`[{"index":".ds-logs-a-000001","status":"open","docs.count":"12"},{"index":"logs-b","status":"close","docs.count":null}]`))
+		case "/_cat/indices/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"type":"index_not_found_exception","reason":"no such index [missing]"},"status":404}`))
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+	})
+
+	query := newTestQuery(t,
+		WithIndices("logs-*", "missing"),
+		WithIgnoreUnavailable(true),
+		WithExpandWildcards("open,hidden"),
+	)
+	infos, err := cli.ResolveIndices(context.TODO(), query)
+	if err != nil {
+		t.Fatalf("ResolveIndices() error = %v", err)
+	}
+	if len(infos) != 2 || infos[0].Docs != 12 || infos[1].Status != "close" {
+		t.Errorf("ResolveIndices() = %+v", infos)
+	}
+}
@@ -2,12 +2,11 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"time"
 
 	"github.com/TCP404/eutil/etl"
-	"github.com/elastic/go-elasticsearch/v7"
-	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/pkg/errors"
 )
 
@@ -17,22 +16,40 @@ type QueryIterator struct {
 	eTime        time.Time
 	err          error
 	query        *QueryConfig
-	client       *elasticsearch.Client
+	client       *ESClient
 	ctx          context.Context
 	tmpContainer BatchHit
 	idx          int
+	pitID        string
+	searchAfter  []json.RawMessage
 }
 
 var _ etl.Iterator[T] = (*QueryIterator)(nil)
 
 func NewQueryIterator(ctx context.Context, client *ESClient, query *QueryConfig) etl.Iterator[T] {
-	return &QueryIterator{
-		sTime:  query.startTime,
-		eTime:  query.endTime,
+	i := &QueryIterator{
 		query:  query,
-		client: client.client,
+		client: client,
 		ctx:    ctx,
 	}
+	start, end := query.startTime, query.endTime
+	if cp := query.resume; cp != nil && !cp.Start.IsZero() {
+		if query.Descending() {
+			end = minTime(end, cp.Start.Add(time.Millisecond))
+		} else {
+			start = maxTime(start, cp.Start)
+		}
+		if query.UsePointInTime() && cp.TieBreaker != "" && cp.TieBreaker == query.tieBreaker {
+			i.searchAfter = cp.SearchAfter
+		}
+	}
+	if query.UsePointInTime() {
+		// a point in time pages through the whole range at once
+		i.sTime, i.eTime = start, end
+	} else {
+		i.sTime, i.eTime = query.firstWindow(start, end)
+	}
+	return i
 }
 
 func (i *QueryIterator) Err() error {
@@ -45,7 +62,7 @@ func (i *QueryIterator) Next() bool {
 	}
 
 	if i.tmpContainer == nil { // first time
-		i.tmpContainer = i.queryValue()
+		i.tmpContainer = i.fetch()
 		i.idx = 0
 		return i.tmpContainer != nil
 	}
@@ -54,8 +71,8 @@ func (i *QueryIterator) Next() bool {
 		return true
 	}
 
-	if i.sTime.Before(i.eTime) { // need to query next batch
-		i.tmpContainer = i.queryValue()
+	if i.hasMore() { // need to query next batch
+		i.tmpContainer = i.fetch()
 		i.idx = 0
 		return i.tmpContainer != nil // if nil, means no more value
 	}
@@ -74,6 +91,60 @@ func (i *QueryIterator) Value() T {
 	return hit
 }
 
+func (i *QueryIterator) hasMore() bool {
+	if i.query.UsePointInTime() {
+		return i.pitID != ""
+	}
+	return i.sTime.Before(i.eTime)
+}
+
+func (i *QueryIterator) fetch() BatchHit {
+	if i.query.UsePointInTime() {
+		return i.queryPITValue()
+	}
+	return i.queryValue()
+}
+
+func (i *QueryIterator) queryPITValue() BatchHit {
+	if i.pitID == "" {
+		pitID, err := openPointInTime(i.ctx, i.client, i.query)
+		if err != nil {
+			i.err = errors.Wrap(err, "open point in time error")
+			return nil
+		}
+		i.pitID = pitID
+	}
+
+	resp, err := searchAfter(i.ctx, i.client, i.query, i.pitID, i.searchAfter, i.sTime, i.eTime)
+	if err != nil {
+		i.err = errors.Wrap(err, "do request error")
+		i.closePIT()
+		return nil
+	}
+	if resp.PitID != "" {
+		i.pitID = resp.PitID
+	}
+
+	hits := resp.Hits.Hits
+	if len(hits) < i.query.batchSize { // last page
+		i.closePIT()
+	} else {
+		i.searchAfter = hits[len(hits)-1].Sort
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+	return hits
+}
+
+func (i *QueryIterator) closePIT() {
+	if err := closePointInTime(context.WithoutCancel(i.ctx), i.client, i.pitID); err != nil {
+		slog.Warn("close point in time error", slog.String("error", err.Error()))
+	}
+	i.pitID = ""
+	i.searchAfter = nil
+}
+
 func (i *QueryIterator) queryValue() BatchHit {
 	body, err := i.query.UpdateBodyTimeRange(i.sTime, i.eTime)
 	if err != nil {
@@ -88,33 +159,19 @@ func (i *QueryIterator) queryValue() BatchHit {
 	}
 
 	slog.Debug("query time range", slog.String("start", i.sTime.Format(ESDateFormat)), slog.String("end", i.eTime.Format(ESDateFormat)))
-	resp, err := doRequest(i.ctx, i.client, esapi.SearchRequest{
-		Index: i.query.index,
-		Body:  bodyReader,
-		Size:  &i.query.body.Size,
-		Sort: []string{i.query.timeField+":asc"},
-	})
+	req := i.query.searchRequest(bodyReader)
+	req.Size = i.query.pageSize()
+	resp, err := i.client.search(i.ctx, i.query, req)
 	if err != nil {
 		i.err = errors.Wrap(err, "do request error")
 		return nil
 	}
 
 	hits := resp.Hits
-	if hits.Total.Value >= 10000 && hits.Total.Relation == "gte" {
-		maxTime := hits.Hits[len(hits.Hits)-1].Source[i.query.timeField].(string)
-		maxTimeT, err := time.Parse(time.RFC3339, maxTime)
-		if err != nil {
-			i.err = errors.Wrap(err, "parse max time error")
-			i.tmpContainer = hits.Hits
-			return hits.Hits
-		}
-
-		i.sTime = maxTimeT
-		// eTime don't need to change
-	} else {
-		// step forward
-		i.sTime = i.eTime
-		i.eTime = time.Unix(min(i.sTime.Add(i.query.stepDuration).Unix(), i.query.endTime.Unix()), 0)
+	if i.sTime, i.eTime, err = i.query.nextWindow(i.sTime, i.eTime, hits); err != nil {
+		i.err = errors.Wrap(err, "next time window error")
+		i.tmpContainer = hits.Hits
+		return hits.Hits
 	}
 
 	if len(hits.Hits) == 0 {
@@ -0,0 +1,330 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QueryString returns a query_string clause running the Lucene query q.
+func QueryString(q string) M {
+	return M{"query_string": M{"query": q}}
+}
+
+// ParseKQL translates a Kibana Query Language expression into a query clause.
+// It supports and, or, not, parentheses, field:value, field:(a or b),
+// field:"a phrase", field:pre* wildcards, field:* for existence and the
+// <, <=, > and >= ranges. Like Kibana, values are matched with match and
+// match_phrase, unquoted words in a row make one value, and terms without a
+// field search every field. An escaped \* is a literal star.
+func ParseKQL(expr string) (M, error) {
+	tokens, err := lexKQL(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return M{"match_all": M{}}, nil
+	}
+	p := &kqlParser{tokens: tokens}
+	clause, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, errors.Errorf("kql: unexpected %q", tok.text)
+	}
+	return clause, nil
+}
+
+type kqlKind int
+
+const (
+	kqlWord kqlKind = iota
+	kqlPhrase
+	kqlLParen
+	kqlRParen
+	kqlColon
+	kqlRange // <, <=, > or >=
+)
+
+type kqlToken struct {
+	kind     kqlKind
+	text     string
+	wildcard bool   // holds an unescaped *
+	pattern  string // text escaped for wildcard queries, if wildcard
+}
+
+func lexKQL(expr string) ([]kqlToken, error) {
+	var tokens []kqlToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, kqlToken{kind: kqlLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, kqlToken{kind: kqlRParen, text: ")"})
+			i++
+		case c == ':':
+			tokens = append(tokens, kqlToken{kind: kqlColon, text: ":"})
+			i++
+		case c == '<' || c == '>':
+			op := expr[i : i+1]
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				op = expr[i : i+2]
+			}
+			tokens = append(tokens, kqlToken{kind: kqlRange, text: op})
+			i += len(op)
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				b.WriteByte(expr[j])
+			}
+			if j == len(expr) {
+				return nil, errors.Errorf("kql: unterminated quote in %q", expr)
+			}
+			tokens = append(tokens, kqlToken{kind: kqlPhrase, text: b.String()})
+			i = j + 1
+		case c == '{' || c == '}':
+			return nil, errors.Errorf("kql: nested field queries are not supported")
+		default:
+			var text, pattern strings.Builder
+			tok := kqlToken{kind: kqlWord}
+			j := i
+			for ; j < len(expr) && !strings.ContainsRune(" \t\n\r():<>\"{}", rune(expr[j])); j++ {
+				escaped := expr[j] == '\\' && j+1 < len(expr)
+				if escaped {
+					j++
+				}
+				c := expr[j]
+				text.WriteByte(c)
+				switch {
+				case c == '*' && !escaped:
+					tok.wildcard = true
+				case c == '*' || c == '?' || c == '\\':
+					pattern.WriteByte('\\')
+				}
+				pattern.WriteByte(c)
+			}
+			tok.text = text.String()
+			if tok.wildcard {
+				tok.pattern = pattern.String()
+			}
+			tokens = append(tokens, tok)
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type kqlParser struct {
+	tokens []kqlToken
+	pos    int
+}
+
+func (p *kqlParser) peek() (kqlToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return kqlToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword consumes the next token if it is the keyword kw.
+func (p *kqlParser) keyword(kw string) bool {
+	tok, ok := p.peek()
+	if ok && tok.kind == kqlWord && strings.EqualFold(tok.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// words extends the word tok with the unquoted words following it, up to a
+// keyword or the next field, into one value as Kibana does.
+func (p *kqlParser) words(tok kqlToken) kqlToken {
+	texts, patterns := []string{tok.text}, []string{tok.pattern}
+	if !tok.wildcard {
+		patterns[0] = escapeWildcard(tok.text)
+	}
+	for ; p.pos < len(p.tokens); p.pos++ {
+		next := p.tokens[p.pos]
+		if next.kind != kqlWord || isKQLKeyword(next.text) {
+			break
+		}
+		if p.pos+1 < len(p.tokens) {
+			if after := p.tokens[p.pos+1].kind; after == kqlColon || after == kqlRange {
+				break
+			}
+		}
+		texts = append(texts, next.text)
+		if next.wildcard {
+			tok.wildcard = true
+			patterns = append(patterns, next.pattern)
+		} else {
+			patterns = append(patterns, escapeWildcard(next.text))
+		}
+	}
+	tok.text = strings.Join(texts, " ")
+	if tok.wildcard {
+		tok.pattern = strings.Join(patterns, " ")
+	}
+	return tok
+}
+
+func isKQLKeyword(text string) bool {
+	return strings.EqualFold(text, "and") || strings.EqualFold(text, "or") || strings.EqualFold(text, "not")
+}
+
+// escapeWildcard escapes the characters of text which wildcard patterns treat
+// specially.
+func escapeWildcard(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`).Replace(text)
+}
+
+func (p *kqlParser) expect(kind kqlKind, what string) error {
+	tok, ok := p.peek()
+	if !ok || tok.kind != kind {
+		return errors.Errorf("kql: expected %v", what)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *kqlParser) or() (M, error) {
+	return p.list(p.and, "or", func(clauses []M) M {
+		return M{"bool": M{"should": clauses, "minimum_should_match": 1}}
+	})
+}
+
+func (p *kqlParser) and() (M, error) {
+	return p.list(p.not, "and", func(clauses []M) M {
+		return M{"bool": M{"filter": clauses}}
+	})
+}
+
+// list parses operands separated by the keyword kw and joins them.
+func (p *kqlParser) list(operand func() (M, error), kw string, join func([]M) M) (M, error) {
+	clause, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []M{clause}
+	for p.keyword(kw) {
+		clause, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return join(clauses), nil
+}
+
+func (p *kqlParser) not() (M, error) {
+	if p.keyword("not") {
+		clause, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return M{"bool": M{"must_not": []M{clause}}}, nil
+	}
+	return p.primary()
+}
+
+func (p *kqlParser) primary() (M, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("kql: unexpected end of query")
+	}
+	switch tok.kind {
+	case kqlLParen:
+		p.pos++
+		clause, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return clause, p.expect(kqlRParen, ")")
+	case kqlPhrase:
+		p.pos++
+		return M{"multi_match": M{"query": tok.text, "type": "phrase", "lenient": true}}, nil
+	case kqlWord:
+		p.pos++
+		next, ok := p.peek()
+		switch {
+		case ok && next.kind == kqlColon:
+			p.pos++
+			return p.values(tok.text)
+		case ok && next.kind == kqlRange:
+			p.pos++
+			value, ok := p.peek()
+			if !ok || (value.kind != kqlWord && value.kind != kqlPhrase) {
+				return nil, errors.Errorf("kql: expected a value after %v %v", tok.text, next.text)
+			}
+			p.pos++
+			op := map[string]string{"<": "lt", "<=": "lte", ">": "gt", ">=": "gte"}[next.text]
+			return M{"range": M{tok.text: M{op: value.text}}}, nil
+		}
+		tok = p.words(tok)
+		if tok.wildcard {
+			return QueryString(tok.pattern), nil
+		}
+		return M{"multi_match": M{"query": tok.text, "lenient": true}}, nil
+	}
+	return nil, errors.Errorf("kql: unexpected %q", tok.text)
+}
+
+// values parses the value of field, a single one or a parenthesized list.
+func (p *kqlParser) values(field string) (M, error) {
+	tok, ok := p.peek()
+	if ok && tok.kind == kqlLParen {
+		p.pos++
+		value := func() (M, error) { return p.value(field) }
+		and := func() (M, error) {
+			return p.list(value, "and", func(clauses []M) M {
+				return M{"bool": M{"filter": clauses}}
+			})
+		}
+		clause, err := p.list(and, "or", func(clauses []M) M {
+			return M{"bool": M{"should": clauses, "minimum_should_match": 1}}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return clause, p.expect(kqlRParen, ")")
+	}
+	return p.value(field)
+}
+
+func (p *kqlParser) value(field string) (M, error) {
+	if p.keyword("not") {
+		clause, err := p.value(field)
+		if err != nil {
+			return nil, err
+		}
+		return M{"bool": M{"must_not": []M{clause}}}, nil
+	}
+	tok, ok := p.peek()
+	if !ok || (tok.kind != kqlWord && tok.kind != kqlPhrase) {
+		return nil, errors.Errorf("kql: expected a value for %v", field)
+	}
+	p.pos++
+	if tok.kind == kqlPhrase {
+		return M{"match_phrase": M{field: tok.text}}, nil
+	}
+	tok = p.words(tok)
+	switch {
+	case tok.wildcard && tok.pattern == "*":
+		return M{"exists": M{"field": field}}, nil
+	case tok.wildcard:
+		return M{"wildcard": M{field: M{"value": tok.pattern}}}, nil
+	}
+	return M{"match": M{field: tok.text}}, nil
+}
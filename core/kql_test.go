@@ -0,0 +1,82 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_ParseKQL(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{
+			expr: `status:200`,
+			want: `{"match":{"status":"200"}}`,
+		},
+		{
+			expr: `service.name:"checkout api" and not level:debug`,
+			want: `{"bool":{"filter":[{"match_phrase":{"service.name":"checkout api"}},{"bool":{"must_not":[{"match":{"level":"debug"}}]}}]}}`,
+		},
+		{
+			expr: `host:web-* or user.id:*`,
+			want: `{"bool":{"minimum_should_match":1,"should":[{"wildcard":{"host":{"value":"web-*"}}},{"exists":{"field":"user.id"}}]}}`,
+		},
+		{
+			expr: `code:(500 or 503) and bytes >= 1024`,
+			want: `{"bool":{"filter":[{"bool":{"minimum_should_match":1,"should":[{"match":{"code":"500"}},{"match":{"code":"503"}}]}},{"range":{"bytes":{"gte":"1024"}}}]}}`,
+		},
+		{
+			expr: `(a:1 OR b:2) AND c:3`,
+			want: `{"bool":{"filter":[{"bool":{"minimum_should_match":1,"should":[{"match":{"a":"1"}},{"match":{"b":"2"}}]}},{"match":{"c":"3"}}]}}`,
+		},
+		{
+			expr: `timeout`,
+			want: `{"multi_match":{"lenient":true,"query":"timeout"}}`,
+		},
+		{
+			expr: `message:hello world`,
+			want: `{"match":{"message":"hello world"}}`,
+		},
+		{
+			expr: `hello world`,
+			want: `{"multi_match":{"lenient":true,"query":"hello world"}}`,
+		},
+		{
+			expr: `status:200 and message:quick brown fox or not level:debug`,
+			want: `{"bool":{"minimum_should_match":1,"should":[{"bool":{"filter":[{"match":{"status":"200"}},{"match":{"message":"quick brown fox"}}]}},{"bool":{"must_not":[{"match":{"level":"debug"}}]}}]}}`,
+		},
+		{
+			expr: `path:\*foo`,
+			want: `{"match":{"path":"*foo"}}`,
+		},
+		{
+			expr: `path:\*foo*`,
+			want: `{"wildcard":{"path":{"value":"\\*foo*"}}}`,
+		},
+		{
+			expr: `file:\*`,
+			want: `{"match":{"file":"*"}}`,
+		},
+		{expr: `status:`, wantErr: true},
+		{expr: `(a:1`, wantErr: true},
+		{expr: `msg:"open`, wantErr: true},
+		{expr: `a:1 b:2 )`, wantErr: true},
+		{expr: `items:{ id:1 }`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKQL(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKQL(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		b, _ := json.Marshal(got)
+		if string(b) != tt.want {
+			t.Errorf("ParseKQL(%q) = %s, want %s", tt.expr, b, tt.want)
+		}
+	}
+}
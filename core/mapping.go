@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// Column is one leaf field of the mapping.
+type Column struct {
+	Name       string // full dotted path
+	Type       string // ES field type
+	Format     string // date format, if any
+	Nested     bool   // under a nested field, so one value per nested object
+	MultiField bool   // a multi-field, absent from _source
+	Fetched    bool   // a multi-field the body asks for by its fields
+}
+
+// Schema is the sorted column list of the indices of a query.
+type Schema []Column
+
+// Names returns the column names, multi-fields excluded unless the body
+// fetches them, since only the fields API returns them.
+func (s Schema) Names() []string {
+	names := make([]string, 0, len(s))
+	for _, c := range s {
+		if !c.MultiField || c.Fetched {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Types returns the type of each column by name.
+func (s Schema) Types() map[string]string {
+	types := make(map[string]string, len(s))
+	for _, c := range s {
+		types[c.Name] = c.Type
+	}
+	return types
+}
+
+// Filter keeps the columns matched by includes, all if nil, and not
+// matched by excludes, with the wildcards of _source filtering.
+func (s Schema) Filter(includes, excludes []string) Schema {
+	var kept Schema
+	for _, c := range s {
+		if (includes == nil || matchField(includes, c.Name)) && !matchField(excludes, c.Name) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// matchField reports whether a pattern selects the field or an object holding
+// it. A * matches any run of characters, dots included.
+func matchField(patterns []string, field string) bool {
+	for _, p := range patterns {
+		if strings.HasPrefix(field, p+".") || wildcardMatch(p, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		n := strings.Index(s, part)
+		if n < 0 {
+			return false
+		}
+		s = s[n+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+type mappingProperty struct {
+	Type       string                     `json:"type"`
+	Format     string                     `json:"format"`
+	Properties map[string]mappingProperty `json:"properties"`
+	Fields     map[string]mappingProperty `json:"fields"`
+}
+
+// Schema reads the mapping of the indices of the query and flattens it into
+// columns, restricted to the _source filtering of the body. Fields mapped with
+// different types across indices keep the first type seen.
+func (e *ESClient) Schema(ctx context.Context, query *QueryConfig) (Schema, error) {
+	var resp map[string]struct {
+		Mappings mappingProperty `json:"mappings"`
+	}
+	err := e.doInto(ctx, esapi.IndicesGetMappingRequest{
+		Index:             query.index,
+		IgnoreUnavailable: query.ignoreUnavailable,
+		AllowNoIndices:    query.allowNoIndices,
+		ExpandWildcards:   query.expandWildcards,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make([]string, 0, len(resp))
+	for index := range resp {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	columns := make(map[string]Column)
+	for _, index := range indices {
+		var flat []Column
+		flattenMapping("", resp[index].Mappings.Properties, false, &flat)
+		for _, c := range flat {
+			seen, ok := columns[c.Name]
+			if !ok {
+				columns[c.Name] = c
+			} else if seen.Type != c.Type {
+				slog.Warn("field mapped differently across indices",
+					slog.String("field", c.Name), slog.String("index", index),
+					slog.String("type", c.Type), slog.String("kept", seen.Type))
+			}
+		}
+	}
+
+	schema := make(Schema, 0, len(columns))
+	for _, c := range columns {
+		schema = append(schema, c)
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name < schema[j].Name })
+	fetched := query.fetchedFields()
+	for n, c := range schema {
+		schema[n].Fetched = c.MultiField && slices.ContainsFunc(fetched, func(p string) bool {
+			return wildcardMatch(p, c.Name)
+		})
+	}
+	return schema.Filter(query.sourceFilter()), nil
+}
+
+func flattenMapping(prefix string, properties map[string]mappingProperty, nested bool, out *[]Column) {
+	for name, p := range properties {
+		full := prefix + name
+		if len(p.Properties) > 0 {
+			flattenMapping(full+".", p.Properties, nested || p.Type == "nested", out)
+			continue
+		}
+		*out = append(*out, Column{Name: full, Type: p.Type, Format: p.Format, Nested: nested})
+		for sub, f := range p.Fields {
+			*out = append(*out, Column{Name: full + "." + sub, Type: f.Type, Format: f.Format, Nested: nested, MultiField: true})
+		}
+	}
+}
+
+// sourceFilter returns the fields selected by the body: the _source filter
+// plus the fetched fields, or only the fetched fields when _source is disabled.
+func (q *QueryConfig) sourceFilter() (includes, excludes []string) {
+	source := q.body.Source
+	if source == nil {
+		return nil, nil
+	}
+	if !source.Disabled {
+		if source.Includes == nil {
+			return nil, source.Excludes
+		}
+		return append(slices.Clone(source.Includes), q.fetchedFields()...), source.Excludes
+	}
+	if includes = q.fetchedFields(); includes == nil {
+		// no _source and no fields, nothing comes back
+		includes = []string{}
+	}
+	return includes, nil
+}
+
+// fetchedFields returns the field patterns the body asks the fields and
+// docvalue_fields of.
+func (q *QueryConfig) fetchedFields() []string {
+	var fields []string
+	for _, f := range append(append([]any{}, q.body.Fields...), q.body.DocvalueFields...) {
+		switch f := f.(type) {
+		case string:
+			fields = append(fields, f)
+		case map[string]any:
+			if name, ok := f["field"].(string); ok {
+				fields = append(fields, name)
+			}
+		case M:
+			if name, ok := f["field"].(string); ok {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
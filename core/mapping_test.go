@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_ESClient_Schema(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs-*/_mapping" {
+			t.Errorf("path = %v", r.URL.Path)
+		}
+		w.Write([]byte(`{
+			"logs-2": {"mappings": {"properties": {
+				"bytes": {"type": "keyword"},
+				"ts": {"type": "date", "format": "epoch_millis"}
+			}}},
+			"logs-1": {"mappings": {"properties": {
+				"bytes": {"type": "long"},
+				"message": {"type": "text", "fields": {"raw": {"type": "keyword"}}},
+				"user": {"properties": {"name": {"type": "keyword"}, "secret": {"type": "keyword"}}},
+				"tags": {"type": "nested", "properties": {"key": {"type": "keyword"}}},
+				"ts": {"type": "date"}
+			}}}
+		}`))
+	})
+	query := newTestQuery(t,
+		WithIndex("logs-*"),
+		WithBody(&ESBody{Source: &ESBodySource{Excludes: []string{"user.secret"}}}),
+	)
+	schema, err := cli.Schema(context.TODO(), query)
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	want := Schema{
+		{Name: "bytes", Type: "long"},
+		{Name: "message", Type: "text"},
+		{Name: "message.raw", Type: "keyword", MultiField: true},
+		{Name: "tags.key", Type: "keyword", Nested: true},
+		{Name: "ts", Type: "date"},
+		{Name: "user.name", Type: "keyword"},
+	}
+	if !reflect.DeepEqual(schema, want) {
+		t.Errorf("Schema() = %+v, want %+v", schema, want)
+	}
+	if names, want := schema.Names(), []string{"bytes", "message", "tags.key", "ts", "user.name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Names() = %v, want %v", names, want)
+	}
+}
+
+func Test_ESClient_Schema_FetchedMultiField(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"logs": {"mappings": {"properties": {
+			"bytes": {"type": "long"},
+			"host": {"type": "keyword"},
+			"message": {"type": "text", "fields": {"raw": {"type": "keyword"}, "en": {"type": "text"}}}
+		}}}}`))
+	})
+	query := newTestQuery(t, WithBody(&ESBody{
+		Source: &ESBodySource{Includes: []string{"bytes"}},
+		Fields: []any{"message.raw"},
+	}))
+	schema, err := cli.Schema(context.TODO(), query)
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	if names, want := schema.Names(), []string{"bytes", "message.raw"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Names() = %v, want %v", names, want)
+	}
+}
+
+func TestSchema_Filter(t *testing.T) {
+	schema := Schema{{Name: "host.ip"}, {Name: "host.name"}, {Name: "message"}, {Name: "user.name"}}
+	tests := []struct {
+		name     string
+		includes []string
+		excludes []string
+		want     []string
+	}{
+		{"all", nil, nil, []string{"host.ip", "host.name", "message", "user.name"}},
+		{"object", []string{"host"}, nil, []string{"host.ip", "host.name"}},
+		{"wildcard", []string{"*.name"}, nil, []string{"host.name", "user.name"}},
+		{"exclude", nil, []string{"host.*"}, []string{"message", "user.name"}},
+		{"none", []string{}, nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schema.Filter(tt.includes, tt.excludes).Names()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
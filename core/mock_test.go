@@ -0,0 +1,43 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/internal/estest"
+)
+
+// newMockClient starts a fake cluster which answers the product check itself
+// and hands every other request to handler.
+func newMockClient(t *testing.T, handler http.HandlerFunc) *ESClient {
+	t.Helper()
+	srv := estest.NewServer(t, handler)
+	cli, err := NewClient([]string{srv.URL}, "", "", 20)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return cli
+}
+
+var (
+	testStart = time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)
+	testEnd   = time.Date(2024, time.November, 8, 0, 0, 0, 0, time.UTC)
+)
+
+// newTestQuery builds a query on the ts field of idx from testStart to
+// testEnd, with opt applied over these defaults.
+func newTestQuery(t *testing.T, opt ...OptFn) *QueryConfig {
+	t.Helper()
+	q, err := NewQueryConfig(append([]OptFn{
+		WithIndex("idx"),
+		WithTimeField("ts"),
+		WithStartTime(testStart),
+		WithEndTime(testEnd),
+		WithBody(&ESBody{}),
+	}, opt...)...)
+	if err != nil {
+		t.Fatalf("NewQueryConfig() error = %v", err)
+	}
+	return q
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TCP404/eutil/etl"
+)
+
+// ParallelIterator runs one QueryIterator per query with at most workers of
+// them in flight. When ordered, hits come out query by query in the given
+// order, otherwise as soon as any worker produces them. A consumer stopping
+// before Next returns false must call Close, or cancel ctx, to release the
+// workers.
+type ParallelIterator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	chans  []chan T
+	cursor int
+	value  T
+	mux    sync.Mutex
+	err    error
+}
+
+var _ etl.Iterator[T] = (*ParallelIterator)(nil)
+
+func NewParallelIterator(ctx context.Context, client *ESClient, queries []*QueryConfig, workers int, ordered bool) etl.Iterator[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	i := &ParallelIterator{ctx: ctx, cancel: cancel}
+
+	workers = max(1, workers)
+	if ordered {
+		i.chans = make([]chan T, len(queries))
+		for n := range i.chans {
+			i.chans[n] = make(chan T, client.chanSize)
+		}
+	} else {
+		i.chans = []chan T{make(chan T, client.chanSize)}
+	}
+
+	go func() {
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, workers)
+		)
+		for n, query := range queries {
+			c := i.chans[min(n, len(i.chans)-1)]
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				if ordered {
+					defer close(c)
+				}
+				i.drain(NewQueryIterator(ctx, client, query), c)
+			}()
+		}
+		if !ordered {
+			wg.Wait()
+			close(i.chans[0])
+		}
+	}()
+	return i
+}
+
+func (i *ParallelIterator) drain(iter etl.Iterator[T], c chan T) {
+	for iter.Next() {
+		select {
+		case <-i.ctx.Done():
+			return
+		case c <- iter.Value():
+		}
+	}
+	if err := iter.Err(); err != nil {
+		i.mux.Lock()
+		if i.err == nil {
+			i.err = err
+		}
+		i.mux.Unlock()
+		i.cancel()
+	}
+}
+
+// Close stops the workers.
+func (i *ParallelIterator) Close() {
+	i.cancel()
+}
+
+// Err returns the first error of the workers, or the error of ctx when it
+// ended the iteration.
+func (i *ParallelIterator) Err() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.err
+}
+
+func (i *ParallelIterator) Next() bool {
+	for i.cursor < len(i.chans) {
+		select {
+		case <-i.ctx.Done():
+			i.mux.Lock()
+			if i.err == nil {
+				i.err = i.ctx.Err()
+			}
+			i.mux.Unlock()
+			return false
+		case hit, ok := <-i.chans[i.cursor]:
+			if ok {
+				i.value = hit
+				return true
+			}
+			i.cursor++
+		}
+	}
+	i.cancel()
+	return false
+}
+
+func (i *ParallelIterator) Value() T {
+	return i.value
+}
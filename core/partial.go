@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+type PartialPolicy int
+
+const (
+	PartialWarn  PartialPolicy = iota // log and keep the hits received
+	PartialFail                       // stop the dump
+	PartialRetry                      // send the page again, then fail
+)
+
+// maxRecordedFailures bounds the shard failures kept for the report.
+const maxRecordedFailures = 100
+
+type PartialResults struct {
+	Responses int // partial responses received
+	TimedOut  int // responses which timed out
+	Skipped   int // shards skipped, summed over partial responses
+	Failed    int // shards failed, summed over partial responses
+	Failures  []ESShardFailure
+}
+
+func (p PartialResults) String() string {
+	return fmt.Sprintf("partial responses: %v, timed out: %v, skipped shards: %v, failed shards: %v",
+		p.Responses, p.TimedOut, p.Skipped, p.Failed)
+}
+
+type partialRecorder struct {
+	mux sync.Mutex
+	PartialResults
+}
+
+func (r *partialRecorder) record(resp *ESResponse) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.Responses++
+	if resp.TimedOut {
+		r.TimedOut++
+	}
+	r.Skipped += resp.Shards.Skipped
+	r.Failed += resp.Shards.Failed
+	for _, f := range resp.Shards.Failures {
+		if len(r.Failures) >= maxRecordedFailures {
+			break
+		}
+		r.Failures = append(r.Failures, f)
+	}
+}
+
+func (r *partialRecorder) snapshot() PartialResults {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	p := r.PartialResults
+	p.Failures = append([]ESShardFailure(nil), r.Failures...)
+	return p
+}
+
+// search sends a search or scroll request and applies the partial results
+// policy of the query to the response. Scroll pages can't be sent again
+// without skipping one, so they fail instead of being retried.
+func (e *ESClient) search(ctx context.Context, query *QueryConfig, req esapi.Request) (*ESResponse, error) {
+	_, isScroll := req.(esapi.ScrollRequest)
+	for attempt := 1; ; attempt++ {
+		resp, err := e.do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Partial() {
+			return resp, nil
+		}
+		query.partial.record(resp)
+
+		switch query.partialPolicy {
+		case PartialWarn:
+			slog.Warn("partial results",
+				slog.Bool("timed_out", resp.TimedOut),
+				slog.Int("failed", resp.Shards.Failed),
+				slog.Int("total", resp.Shards.Total),
+			)
+			return resp, nil
+		case PartialRetry:
+			if isScroll || attempt >= e.retry.MaxAttempts {
+				return nil, PartialResultsErr(resp)
+			}
+			// a retried first page opens a new scroll, drop the old one
+			if err := e.clearScroll(ctx, resp.ScrollID); err != nil {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, PartialResultsErr(resp)
+			case <-time.After(e.retry.backoff(attempt, nil)):
+			}
+		default:
+			return nil, PartialResultsErr(resp)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+func Test_ESClient_search_PartialPolicy(t *testing.T) {
+	const partial = `{"timed_out":false,"_shards":{"total":3,"successful":2,"skipped":0,"failed":1,` +
+		`"failures":[{"shard":1,"index":"idx","node":"n1","reason":{"type":"node_disconnected_exception","reason":"gone"}}]},` +
+		`"hits":{"hits":[{"_id":"1"}]}}`
+	const complete = `{"_shards":{"total":3,"successful":3},"hits":{"hits":[{"_id":"1"},{"_id":"2"}]}}`
+
+	tests := []struct {
+		policy   PartialPolicy
+		wantHits int
+		wantErr  bool
+	}{
+		{PartialWarn, 1, false},
+		{PartialFail, 0, true},
+		{PartialRetry, 2, false},
+	}
+	for _, tt := range tests {
+		var calls int
+		cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Write([]byte(partial))
+				return
+			}
+			w.Write([]byte(complete))
+		})
+		cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+		query := newTestQuery(t, WithPartialResults(tt.policy))
+
+		resp, err := cli.search(context.TODO(), query, esapi.SearchRequest{Index: []string{"idx"}})
+		var partialErr PartialResultsError
+		if gotErr := errors.As(err, &partialErr); gotErr != tt.wantErr {
+			t.Errorf("policy %v: search() error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			if len(partialErr.Failures) != 1 {
+				t.Errorf("policy %v: PartialResultsError.Failures = %v, want 1", tt.policy, partialErr.Failures)
+			}
+		} else if len(resp.Hits.Hits) != tt.wantHits {
+			t.Errorf("policy %v: search() got %v hits, want %v", tt.policy, len(resp.Hits.Hits), tt.wantHits)
+		}
+		if got := query.PartialResults(); got.Responses != 1 || got.Failed != 1 || len(got.Failures) != 1 {
+			t.Errorf("policy %v: PartialResults() = %+v", tt.policy, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+func openPointInTime(ctx context.Context, cli *ESClient, query *QueryConfig) (string, error) {
+	resp, err := cli.do(ctx, esapi.OpenPointInTimeRequest{
+		Index:             query.index,
+		KeepAlive:         formatDuration(query.pitKeepAlive),
+		IgnoreUnavailable: query.ignoreUnavailable,
+		ExpandWildcards:   query.expandWildcards,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func closePointInTime(ctx context.Context, cli *ESClient, pitID string) error {
+	if pitID == "" {
+		return nil
+	}
+	bodyReader, err := marshalBytesBreader(&ESBodyPit{ID: pitID})
+	if err != nil {
+		return err
+	}
+	_, err = cli.do(ctx, esapi.ClosePointInTimeRequest{Body: bodyReader})
+	return err
+}
+
+func searchAfter(ctx context.Context, cli *ESClient, query *QueryConfig, pitID string, after []json.RawMessage, start, end time.Time) (*ESResponse, error) {
+	body, err := query.UpdateBodySearchAfter(pitID, after, start, end)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader, err := marshalBytesBreader(body)
+	if err != nil {
+		return nil, err
+	}
+	// index must not be set when searching a point in time
+	return cli.search(ctx, query, esapi.SearchRequest{Body: bodyReader})
+}
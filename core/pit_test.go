@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// pitHandler serves total docs one minute apart from testStart, filtered by
+// the time range of the body and paged by search_after.
+func pitHandler(t *testing.T, total int, closed *bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/idx/_pit":
+			w.Write([]byte(`{"id":"pit-1"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+			*closed = true
+			w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+		case r.URL.Path == "/_search":
+			var body ESBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("decode search body error = %v", err)
+			}
+			if body.Pit == nil || body.Pit.ID != "pit-1" {
+				t.Errorf("search body pit = %v, want pit-1", body.Pit)
+			}
+			rng := body.Query.Bool.Filter[0]["range"].(map[string]any)["ts"].(map[string]any)
+			gte, err := time.Parse(time.RFC3339, rng["gte"].(string))
+			if err != nil {
+				t.Errorf("range gte error = %v", err)
+			}
+			start := 0
+			if len(body.SearchAfter) == 2 {
+				json.Unmarshal(body.SearchAfter[1], &start)
+				start++
+			}
+			var hits BatchHit
+			for n := start; n < total && len(hits) < body.Size; n++ {
+				ts := testStart.Add(time.Duration(n) * time.Minute)
+				if ts.Before(gte) {
+					continue
+				}
+				hits = append(hits, Hit{
+					ID:     fmt.Sprint(n),
+					Source: M{"ts": ts.Format(time.RFC3339)},
+					Sort:   []json.RawMessage{json.RawMessage(fmt.Sprint(ts.UnixMilli())), json.RawMessage(fmt.Sprint(n))},
+				})
+			}
+			json.NewEncoder(w).Encode(ESResponse{PitID: "pit-1", Hits: Hits{Hits: hits}})
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func newPITQuery(t *testing.T) *QueryConfig {
+	return newTestQuery(t, WithBatchSize(10), WithPointInTime(time.Minute))
+}
+
+func Test_QueryIterator_PointInTime(t *testing.T) {
+	var closed bool
+	cli := newMockClient(t, pitHandler(t, 25, &closed))
+
+	iter := NewQueryIterator(context.TODO(), cli, newPITQuery(t))
+	seen := make(map[string]struct{})
+	for iter.Next() {
+		seen[iter.Value().ID] = struct{}{}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("QueryIterator.Err() = %v", err)
+	}
+	if len(seen) != 25 {
+		t.Errorf("QueryIterator got %v unique hits, want 25", len(seen))
+	}
+	if !closed {
+		t.Error("point in time was not closed")
+	}
+}
+
+func Test_ESClient_FindWithConsume_PointInTime(t *testing.T) {
+	var closed bool
+	cli := newMockClient(t, pitHandler(t, 30, &closed))
+
+	var got int
+	err := cli.FindWithConsume(context.TODO(), newPITQuery(t), func(c chan Hit) {
+		for range c {
+			got++
+		}
+	})
+	if err != nil {
+		t.Fatalf("FindWithConsume() error = %v", err)
+	}
+	if got != 30 {
+		t.Errorf("FindWithConsume() got %v hits, want 30", got)
+	}
+	if !closed {
+		t.Error("point in time was not closed")
+	}
+}
+
+func Test_QueryIterator_PointInTimeResume(t *testing.T) {
+	tests := []struct {
+		tieBreaker string
+		want       int
+	}{
+		{"_shard_doc", 16}, // from the timestamp, the old _shard_doc is meaningless
+		{"_id", 15},        // exactly after the checkpoint
+	}
+	for _, tt := range tests {
+		t.Run(tt.tieBreaker, func(t *testing.T) {
+			var closed bool
+			cli := newMockClient(t, pitHandler(t, 25, &closed))
+			query := newPITQuery(t).With(WithTieBreaker(tt.tieBreaker))
+			cp := &Checkpoint{Start: testStart, End: testEnd}
+			last := testStart.Add(9 * time.Minute)
+			cp.Advance(query, Hit{
+				ID:   "9",
+				Sort: []json.RawMessage{json.RawMessage(fmt.Sprint(last.UnixMilli())), json.RawMessage("9")},
+			}, 10)
+
+			iter := NewQueryIterator(context.TODO(), cli, query.With(WithResume(cp)))
+			var got int
+			for iter.Next() {
+				iter.Value()
+				got++
+			}
+			if err := iter.Err(); err != nil {
+				t.Fatalf("QueryIterator.Err() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("QueryIterator resumed with %v hits, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,14 @@ package core
 import (
 	"bytes"
 	"io"
+	"log/slog"
+	"slices"
 	"time"
 
 	"encoding/json"
 
 	"github.com/TCP404/eutil"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 )
 
 type QueryConfig struct {
@@ -21,12 +24,18 @@ type OptFn func(*QueryConfig)
 func NewQueryConfig(opt ...OptFn) (*QueryConfig, error) {
 	q := new(QueryConfig)
 	q.batchSize = 1000
+	q.scroll = 3 * time.Minute
+	q.tieBreaker = "_shard_doc"
+	q.partial = new(partialRecorder)
 	for _, o := range opt {
 		o(q)
 	}
 	if q.timeField == "" {
 		return nil, ESQueryVarifyErr("time field is required")
 	}
+	if err := q.resolveDateMath(); err != nil {
+		return nil, ESQueryVarifyErr(err.Error())
+	}
 	if q.startTime.IsZero() {
 		return nil, ESQueryVarifyErr("start time is required")
 	}
@@ -36,14 +45,15 @@ func NewQueryConfig(opt ...OptFn) (*QueryConfig, error) {
 	if q.stepByDay == 0 {
 		q.stepDuration = q.endTime.Sub(q.startTime)
 	}
-	q.body.Query.Bool.Filter = append(q.body.Query.Bool.Filter, M{
-		"range": M{
-			q.timeField: M{
-				"gte": q.startTime.Format(ESDateFormat),
-				"lt":  q.endTime.Format(ESDateFormat),
-			},
-		},
-	})
+	if err := q.verifySort(); err != nil {
+		return nil, err
+	}
+	format, err := parseTimeFormat(q.timeMapping)
+	if err != nil {
+		return nil, err
+	}
+	q.timeFormat = format
+	q.replaceBodyTimeRange()
 
 	b, err := json.Marshal(q.body)
 	if err != nil {
@@ -54,6 +64,18 @@ func NewQueryConfig(opt ...OptFn) (*QueryConfig, error) {
 	return q, nil
 }
 
+// replaceBodyTimeRange puts the time range of the query in place of the one
+// a body pasted from Kibana comes with, so that the count, the scroll and the
+// windows all filter the same.
+func (q *QueryConfig) replaceBodyTimeRange() {
+	bool := &q.body.Query.Bool
+	if slices.ContainsFunc(bool.Must, q.isTimeRange) || slices.ContainsFunc(bool.Filter, q.isTimeRange) {
+		slog.Warn("search body time range replaced", slog.String("field", q.timeField))
+	}
+	bool.Must = slices.DeleteFunc(bool.Must, q.isTimeRange)
+	bool.Filter = q.replaceTimeRange(bool.Filter, q.startTime, q.endTime)
+}
+
 func (q *QueryConfig) With(opt ...OptFn) *QueryConfig {
 	for _, o := range opt {
 		o(q)
@@ -66,28 +88,53 @@ func (q *QueryConfig) UpdateBodyTimeRange(startTime, endTime time.Time) (*ESBody
 	if err := eutil.DeepCopy(*q.body, newBody); err != nil {
 		return nil, err
 	}
-	filters := make([]M, 0, len(newBody.Query.Bool.Filter))
-	for _, v := range newBody.Query.Bool.Filter {
-		if _, ok := v["range"]; ok {
-			filters = append(filters, M{
-				"range": M{
-					q.timeField: M{
-						"gte": startTime.Format(ESDateFormat),
-						"lt":  endTime.Format(ESDateFormat),
-					},
-				},
-			})
-			continue
-		}
-		filters = append(filters, v)
-	}
-	newBody.Query.Bool.Filter = filters
+	newBody.Query.Bool.Filter = q.replaceTimeRange(newBody.Query.Bool.Filter, startTime, endTime)
+	newBody.Sort = q.sortBody()
+	return newBody, nil
+}
+
+// UpdateBodySearchAfter returns a copy of the body that pages through the
+// point in time pitID over [startTime, endTime), starting after the sort
+// values of the previous page.
+func (q *QueryConfig) UpdateBodySearchAfter(pitID string, searchAfter []json.RawMessage, startTime, endTime time.Time) (*ESBody, error) {
+	var newBody = new(ESBody)
+	if err := eutil.DeepCopy(*q.body, newBody); err != nil {
+		return nil, err
+	}
+	newBody.Query.Bool.Filter = q.replaceTimeRange(newBody.Query.Bool.Filter, startTime, endTime)
+	newBody.Pit = &ESBodyPit{ID: pitID, KeepAlive: formatDuration(q.pitKeepAlive)}
+	newBody.Sort = q.sortBody()
+	if !q.sortsBy(q.tieBreaker) {
+		newBody.Sort = append(newBody.Sort, M{q.tieBreaker: "asc"})
+	}
+	newBody.SearchAfter = searchAfter
+	newBody.Size = q.batchSize
+	return newBody, nil
+}
+
+func (q *QueryConfig) UsePointInTime() bool {
+	return q.pitKeepAlive > 0
+}
+
+// UpdateBodySlice returns a copy of the body restricted to one scroll slice.
+// A nil slice returns the body as is.
+func (q *QueryConfig) UpdateBodySlice(slice *ESBodySlice) (*ESBody, error) {
+	if slice == nil {
+		return q.body, nil
+	}
+	var newBody = new(ESBody)
+	if err := eutil.DeepCopy(*q.body, newBody); err != nil {
+		return nil, err
+	}
+	newBody.Slice = slice
 	return newBody, nil
 }
 
 type ScrollConfig struct {
-	scroll    time.Duration
-	batchSize int
+	scroll         time.Duration
+	scrollInterval time.Duration
+	batchSize      int
+	slices         int // 0 or 1 to not slice
 }
 
 func WithScroll(scroll time.Duration) OptFn {
@@ -96,6 +143,21 @@ func WithScroll(scroll time.Duration) OptFn {
 	}
 }
 
+// WithScrollInterval sets the pause between two scroll pages of one cursor,
+// to spare a busy cluster. There is none by default.
+func WithScrollInterval(interval time.Duration) OptFn {
+	return func(c *QueryConfig) {
+		c.scrollInterval = interval
+	}
+}
+
+// WithSlices splits the scroll into n slices which are scrolled concurrently.
+func WithSlices(n int) OptFn {
+	return func(c *QueryConfig) {
+		c.slices = n
+	}
+}
+
 func WithBatchSize(batchSize int) OptFn {
 	return func(c *QueryConfig) {
 		c.batchSize = batchSize
@@ -105,6 +167,15 @@ func WithBatchSize(batchSize int) OptFn {
 type SearchConfig struct {
 	stepByDay    int // 0 to not step
 	stepDuration time.Duration
+	pitKeepAlive time.Duration // 0 to not use point in time
+	tieBreaker   string
+	resume       *Checkpoint
+	sort         []SortField
+
+	partialPolicy PartialPolicy
+	partial       *partialRecorder // shared by the windows of the query
+
+	dateMathPassthrough bool
 }
 
 func WithStepByDay(stepByDay int) OptFn {
@@ -114,14 +185,64 @@ func WithStepByDay(stepByDay int) OptFn {
 	}
 }
 
+// WithPointInTime switches extraction to point in time + search_after paging,
+// which keeps every hit exactly once even when timestamps collide.
+func WithPointInTime(keepAlive time.Duration) OptFn {
+	return func(c *QueryConfig) {
+		c.pitKeepAlive = keepAlive
+	}
+}
+
+// WithTieBreaker sets the sort field used after the time field in point in time
+// mode. It defaults to _shard_doc, use _id for clusters older than 7.12 or to
+// resume a checkpoint exactly.
+func WithTieBreaker(field string) OptFn {
+	return func(c *QueryConfig) {
+		c.tieBreaker = field
+	}
+}
+
+// WithResume continues the query after the last hit recorded by cp. In point
+// in time mode with a tie-breaker other than _shard_doc the dump continues
+// exactly after that hit, otherwise from its timestamp, so hits sharing that
+// timestamp may be written again.
+func WithResume(cp *Checkpoint) OptFn {
+	return func(c *QueryConfig) {
+		c.resume = cp
+	}
+}
+
+// WithPartialResults sets what happens to responses missing the hits of
+// failed or timed out shards. It defaults to PartialWarn.
+func WithPartialResults(policy PartialPolicy) OptFn {
+	return func(c *QueryConfig) {
+		c.partialPolicy = policy
+	}
+}
+
+// PartialResults summarizes the partial responses received so far.
+func (q *QueryConfig) PartialResults() PartialResults {
+	return q.partial.snapshot()
+}
+
 type QueryParam struct {
-	index      []string
-	body       *ESBody
-	BodyBytes  []byte
-	timeField  string
-	startTime  time.Time
-	endTime    time.Time
-	bodyReader io.Reader
+	index             []string
+	ignoreUnavailable *bool
+	allowNoIndices    *bool
+	expandWildcards   string
+	body              *ESBody
+	BodyBytes         []byte
+	timeField         string
+	timeMapping       TimeMapping
+	timeFormat        timeFormat
+	timeZone          *time.Location
+	startTime         time.Time
+	endTime           time.Time
+	startExpr         string
+	endExpr           string
+	now               time.Time
+	columns           []string
+	bodyReader        io.Reader
 }
 
 func WithIndex(index string) OptFn {
@@ -130,6 +251,45 @@ func WithIndex(index string) OptFn {
 	}
 }
 
+// WithIndices targets several indices, aliases or data streams, each of them
+// possibly a wildcard pattern.
+func WithIndices(indices ...string) OptFn {
+	return func(c *QueryConfig) {
+		c.index = indices
+	}
+}
+
+func WithIgnoreUnavailable(ignore bool) OptFn {
+	return func(c *QueryConfig) {
+		c.ignoreUnavailable = &ignore
+	}
+}
+
+func WithAllowNoIndices(allow bool) OptFn {
+	return func(c *QueryConfig) {
+		c.allowNoIndices = &allow
+	}
+}
+
+// WithExpandWildcards sets which indices wildcards match: open, closed,
+// hidden, none or all, comma separated.
+func WithExpandWildcards(expand string) OptFn {
+	return func(c *QueryConfig) {
+		c.expandWildcards = expand
+	}
+}
+
+// searchRequest returns a search request over the indices of the query.
+func (q *QueryConfig) searchRequest(body io.Reader) esapi.SearchRequest {
+	return esapi.SearchRequest{
+		Index:             q.index,
+		Body:              body,
+		IgnoreUnavailable: q.ignoreUnavailable,
+		AllowNoIndices:    q.allowNoIndices,
+		ExpandWildcards:   q.expandWildcards,
+	}
+}
+
 func WithTimeField(timeField string) OptFn {
 	return func(c *QueryConfig) {
 		c.timeField = timeField
@@ -158,4 +318,4 @@ func WithSize(size int) OptFn {
 	return func(c *QueryConfig) {
 		c.body.Size = size
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// bodyKeys are the keys ParseESBody keeps. The others, such as sort, from,
+// aggs or highlight, are set by the dump itself or have no use in it.
+var bodyKeys = []string{"query", "size", "_source", "fields", "docvalue_fields", "stored_fields", "runtime_mappings"}
+
+// ParseESBody reads a search body written in the query DSL, as copied from
+// Kibana Dev Tools, to pass to WithBody. Queries other than bool are wrapped
+// in a bool so the time range filter can be added. Keys other than bodyKeys
+// are dropped with a warning, sort included since it is set by WithSort. A
+// range on the time field, in filter or must, gives way to the time range of
+// the query.
+func ParseESBody(r io.Reader) (*ESBody, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, UnmarshalErr(err)
+	}
+	var dropped []string
+	for key := range keys {
+		if !slices.Contains(bodyKeys, key) {
+			dropped = append(dropped, key)
+			delete(keys, key)
+		}
+	}
+	if len(dropped) > 0 {
+		slices.Sort(dropped)
+		slog.Warn("search body keys dropped", slog.Any("keys", dropped))
+	}
+	if b, err = json.Marshal(keys); err != nil {
+		return nil, MarshalErr(err)
+	}
+
+	body := new(ESBody)
+	if err := json.Unmarshal(b, body); err != nil {
+		return nil, UnmarshalErr(err)
+	}
+	// a bool of only should clauses needs one of them to match, which stops
+	// being the default once the time range filter is added
+	bool := &body.Query.Bool
+	if len(bool.Should) > 0 && len(bool.Must) == 0 && len(bool.Filter) == 0 && bool.MinimumShouldMatch == nil {
+		bool.MinimumShouldMatch = 1
+	}
+	return body, nil
+}
+
+func ParseESBodyString(s string) (*ESBody, error) {
+	return ParseESBody(strings.NewReader(s))
+}
+
+func ParseESBodyFile(path string) (*ESBody, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseESBody(f)
+}
+
+// QueryExplanation is the validation result of the query on one index.
+type QueryExplanation struct {
+	Index       string `json:"index"`
+	Shard       int    `json:"shard"`
+	Valid       bool   `json:"valid"`
+	Explanation string `json:"explanation,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ValidateQuery checks the query of the body, time range included, with the
+// _validate/query API and returns how ES rewrote it.
+func (e *ESClient) ValidateQuery(ctx context.Context, query *QueryConfig) ([]QueryExplanation, error) {
+	bodyReader, err := marshalBytesBreader(M{"query": query.body.Query})
+	if err != nil {
+		return nil, err
+	}
+	explain := true
+	var resp struct {
+		Valid        bool               `json:"valid"`
+		Error        string             `json:"error"`
+		Explanations []QueryExplanation `json:"explanations"`
+	}
+	err = e.doInto(ctx, esapi.IndicesValidateQueryRequest{
+		Index:             query.index,
+		Body:              bodyReader,
+		Explain:           &explain,
+		IgnoreUnavailable: query.ignoreUnavailable,
+		AllowNoIndices:    query.allowNoIndices,
+		ExpandWildcards:   query.expandWildcards,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return resp.Explanations, QueryInvalidErr(resp.Error, resp.Explanations)
+	}
+	return resp.Explanations, nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_ParseESBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "non bool query is wrapped",
+			raw:  `{"query":{"match":{"message":"timeout"}},"_source":["message"]}`,
+			want: `{"bool":{"filter":[{"range":{"ts":{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}}}],"must":[{"match":{"message":"timeout"}}]}}`,
+		},
+		{
+			name: "should only bool keeps one match required",
+			raw:  `{"query":{"bool":{"should":[{"term":{"a":1}},{"term":{"b":2}}]}}}`,
+			want: `{"bool":{"filter":[{"range":{"ts":{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}}}],"should":[{"term":{"a":1}},{"term":{"b":2}}],"minimum_should_match":1}}`,
+		},
+		{
+			name: "bool with unmodeled options is wrapped",
+			raw:  `{"query":{"bool":{"filter":{"term":{"a":1}},"boost":2}}}`,
+			want: `{"bool":{"filter":[{"range":{"ts":{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}}}],"must":[{"bool":{"boost":2,"filter":{"term":{"a":1}}}}]}}`,
+		},
+		{
+			name: "keys set by the dump are dropped",
+			raw:  `{"query":{"match_all":{}},"sort":["ts"],"from":10,"aggs":{"n":{"terms":{"field":"a"}}},"track_total_hits":true,"timeout":"1s","highlight":{}}`,
+			want: `{"bool":{"filter":[{"range":{"ts":{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			name: "time range of the body is replaced",
+			raw:  `{"query":{"bool":{"must":[{"range":{"ts":{"gte":"now-15m"}}}],"filter":[{"match_phrase":{"level":"error"}},{"range":{"ts":{"gte":"2024-01-01T00:00:00.000Z","lte":"2024-01-02T00:00:00.000Z","format":"strict_date_optional_time"}}}]}}}`,
+			want: `{"bool":{"filter":[{"match_phrase":{"level":"error"}},{"range":{"ts":{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}}}]}}`,
+		},
+		{name: "not json", raw: `{"query":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := ParseESBodyString(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseESBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(body.Sort) > 0 || len(body.Aggs) > 0 {
+				t.Errorf("body sort %v, aggs %v, want them dropped", body.Sort, body.Aggs)
+			}
+			q := newTestQuery(t, WithBody(body))
+			got, _ := json.Marshal(q.body.Query)
+			if string(got) != tt.want {
+				t.Errorf("query = %s, want %s", got, tt.want)
+			}
+			// the count sends the same query as the windows
+			window, err := q.UpdateBodyTimeRange(q.startTime, q.endTime)
+			if err != nil {
+				t.Fatalf("UpdateBodyTimeRange() error = %v", err)
+			}
+			if got, _ := json.Marshal(window.Query); string(got) != tt.want {
+				t.Errorf("window query = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ESClient_ValidateQuery(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/idx/_validate/query" || r.URL.Query().Get("explain") != "true" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		}
+		b, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(b), `"range"`) {
+			t.Errorf("validated query %s misses the time range", b)
+		}
+		w.Write([]byte(`{"valid":false,"_shards":{"total":1,"successful":1,"failed":0},` +
+			`"explanations":[{"index":"idx","valid":false,"error":"failed to create query: For input string: \"abc\""}]}`))
+	})
+	body, err := ParseESBodyString(`{"query":{"term":{"status":"abc"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newTestQuery(t, WithBody(body))
+	_, err = cli.ValidateQuery(context.TODO(), q)
+	var invalid QueryInvalidError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("ValidateQuery() error = %v, want QueryInvalidError", err)
+	}
+	if len(invalid.Explanations) != 1 || !strings.Contains(invalid.Error(), "For input string") {
+		t.Errorf("ValidateQuery() error = %v, explanations %+v", invalid, invalid.Explanations)
+	}
+}
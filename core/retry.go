@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int // 1 to not retry
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Jitter      float64 // fraction of the backoff which is randomized, 0 ~ 1
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: 500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+}
+
+// backoff returns the wait before the retry following the given attempt,
+// starting at 1. A Retry-After asked by the cluster wins, up to MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var respErr ESResponseError
+	if errors.As(err, &respErr) && respErr.retryAfter > 0 {
+		return min(respErr.retryAfter, p.MaxBackoff)
+	}
+	d := p.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// IsRetryable reports whether err is transient, see ESRequestError.IsRetryable
+// and ESResponseError.IsRetryable.
+func IsRetryable(err error) bool {
+	var r interface{ IsRetryable() bool }
+	return errors.As(err, &r) && r.IsRetryable()
+}
+
+func (e *ESClient) do(ctx context.Context, req esapi.Request) (*ESResponse, error) {
+	var result ESResponse
+	if err := e.doInto(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// doInto sends req with doRequest, retrying it on retryable errors
+// according to the retry policy of the client.
+func (e *ESClient) doInto(ctx context.Context, req esapi.Request, out any) error {
+	for attempt := 1; ; attempt++ {
+		resendable := canResend(req)
+		err := doRequest(ctx, e.client, req, out, e.exactNumbers)
+		if err == nil || !resendable || attempt >= e.retry.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+		if _, ok := req.(esapi.ScrollRequest); ok && !rejected(err) {
+			return err
+		}
+
+		wait := e.retry.backoff(attempt, err)
+		slog.Warn("retry es request",
+			slog.Int("attempt", attempt),
+			slog.Duration("wait", wait),
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// canResend reports whether req can be sent again after a failure.
+func canResend(req esapi.Request) bool {
+	return rewindBody(req) == nil
+}
+
+// rejected reports whether the cluster refused the request without running
+// it, so that even a scroll page can be asked for again. After any other
+// failure the page may have been served, and asking again would skip it.
+func rejected(err error) bool {
+	var respErr ESResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.Status() {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return respErr.Is(ErrRejectedExecution)
+}
+
+// rewindBody seeks the body of req back to its start, so that the request
+// can be sent again.
+func rewindBody(req esapi.Request) error {
+	v := reflect.ValueOf(req)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.FieldByName("Body")
+	if !field.IsValid() || field.IsNil() {
+		return nil
+	}
+	seeker, ok := field.Interface().(io.Seeker)
+	if !ok {
+		return errors.New("request body can not be rewound")
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// parseRetryAfter parses the seconds form of the Retry-After header.
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
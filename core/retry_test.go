@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+func Test_ESClient_do_Retry(t *testing.T) {
+	var (
+		calls int
+		first []byte
+	)
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if first == nil {
+			first = body
+		}
+		if len(body) == 0 || !bytes.Equal(body, first) {
+			t.Errorf("attempt %v sent body %q, want %q", calls, body, first)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"type":"es_rejected_execution_exception"},"status":429}`))
+			return
+		}
+		w.Write([]byte(`{"count":42}`))
+	})
+	cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	count, err := cli.Count(context.TODO(), newTestQuery(t))
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 42 || calls != 3 {
+		t.Errorf("Count() = %v after %v calls, want 42 after 3 calls", count, calls)
+	}
+}
+
+func Test_ESClient_WithRetryPolicy(t *testing.T) {
+	var calls int
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	retrying := cli.WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	if _, err := retrying.Count(context.TODO(), newTestQuery(t)); err == nil {
+		t.Fatal("Count() error = nil, want the 429")
+	}
+	if calls != 3 {
+		t.Errorf("copy sent %v requests, want 3", calls)
+	}
+
+	calls = 0
+	if _, err := cli.Count(context.TODO(), newTestQuery(t)); err == nil {
+		t.Fatal("Count() error = nil, want the 429")
+	}
+	if calls != 1 {
+		t.Errorf("original sent %v requests, want 1", calls)
+	}
+}
+
+func Test_ESResponseError_IsRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusServiceUnavailable, "", true},
+		{http.StatusInternalServerError, `{"error":{"type":"es_rejected_execution_exception"}}`, true},
+		{http.StatusNotFound, `{"error":{"type":"index_not_found_exception"}}`, false},
+		{http.StatusBadRequest, "", false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(ESResponseErr(nil, tt.status, tt.body)); got != tt.want {
+			t.Errorf("IsRetryable(%v %v) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+func Test_ESClient_do_NoRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		req    esapi.Request
+		status int
+	}{
+		// the transport must not retry on its own
+		{"single attempt", RetryPolicy{MaxAttempts: 1}, esapi.CountRequest{Index: []string{"idx"}}, http.StatusServiceUnavailable},
+		// the page may have been served behind the gateway
+		{"scroll", RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			esapi.ScrollRequest{ScrollID: "scroll-1", Scroll: time.Minute}, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tt.status)
+			})
+			cli.SetRetryPolicy(tt.policy)
+			if _, err := cli.do(context.TODO(), tt.req); err == nil {
+				t.Fatalf("do() error = nil, want the %v", tt.status)
+			}
+			if calls != 1 {
+				t.Errorf("do() sent %v requests, want 1", calls)
+			}
+		})
+	}
+}
+
+func Test_ESClient_do_RetryScrollRejected(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			var calls int
+			cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.WriteHeader(status)
+					w.Write([]byte(`{"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"}}`))
+					return
+				}
+				w.Write([]byte(`{"_scroll_id":"scroll-1","hits":{"hits":[]}}`))
+			})
+			cli.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+			if _, err := cli.do(context.TODO(), esapi.ScrollRequest{ScrollID: "scroll-1", Scroll: time.Minute}); err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			if calls != 2 {
+				t.Errorf("do() sent %v requests, want 2", calls)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_backoff_RetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Second}
+	err := ESResponseErr(nil, http.StatusTooManyRequests, "")
+	err.retryAfter = time.Hour
+	if got := policy.backoff(1, err); got != time.Second {
+		t.Errorf("backoff() with Retry-After 1h = %v, want MaxBackoff %v", got, time.Second)
+	}
+}
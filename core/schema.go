@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 const ESDateFormat = "2006-01-02T15:04:05.999Z"
@@ -41,11 +42,14 @@ func (m M) GetHeader() []string {
 }
 
 type Hit struct {
-	ID     string  `json:"_id"`
-	Type   string  `json:"_type"`
-	Score  float64 `json:"_score"`
-	Index  string  `json:"_index"`
-	Source M       `json:"_source"`
+	ID      string            `json:"_id"`
+	Type    string            `json:"_type"`
+	Score   float64           `json:"_score"`
+	Index   string            `json:"_index"`
+	Routing string            `json:"_routing,omitempty"`
+	Source  M                 `json:"_source"`
+	Fields  M                 `json:"fields,omitempty"`
+	Sort    []json.RawMessage `json:"sort,omitempty"`
 }
 
 func (h Hit) GetHeader() []string {
@@ -53,11 +57,46 @@ func (h Hit) GetHeader() []string {
 	for k := range h.Source {
 		header = append(header, k)
 	}
+	for k := range h.Fields {
+		if _, ok := h.Source[k]; !ok {
+			header = append(header, k)
+		}
+	}
 	return header
 }
 
+// GetValue returns the source merged with the requested fields. Fields win
+// over the source since they hold the formatted values, and their single
+// value arrays are unwrapped.
 func (h Hit) GetValue() M {
-	return h.Source
+	if len(h.Fields) == 0 {
+		return h.Source
+	}
+	value := make(M, len(h.Source)+len(h.Fields))
+	for k, v := range h.Source {
+		value[k] = v
+	}
+	for k, v := range h.Fields {
+		if values, ok := v.([]any); ok && len(values) == 1 {
+			v = values[0]
+		}
+		value[k] = v
+	}
+	return value
+}
+
+// SortTime returns the time field value ES sorted the hit by, which is the
+// first sort value in epoch millis for date fields. Use QueryConfig.HitTime
+// for fields of other types.
+func (h Hit) SortTime() (time.Time, bool) {
+	if len(h.Sort) == 0 {
+		return time.Time{}, false
+	}
+	var millis int64
+	if err := json.Unmarshal(h.Sort[0], &millis); err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
 }
 
 type BatchHit = []Hit
@@ -72,24 +111,90 @@ type Hits struct {
 }
 
 type ESResponse struct {
+	ID       string `json:"id"`
 	ScrollID string `json:"_scroll_id"`
+	PitID    string `json:"pit_id"`
 	Took     int    `json:"took"`
 	TimedOut bool   `json:"timed_out"`
 	Count    int64  `json:"count"`
 	Shards   struct {
-		Total      int `json:"total"`
-		Successful int `json:"successful"`
-		Skipped    int `json:"skipped"`
-		Failed     int `json:"failed"`
+		Total      int              `json:"total"`
+		Successful int              `json:"successful"`
+		Skipped    int              `json:"skipped"`
+		Failed     int              `json:"failed"`
+		Failures   []ESShardFailure `json:"failures,omitempty"`
 	} `json:"_shards"`
 	Hits         Hits `json:"hits"`
 	Aggregations M    `json:"aggregations,omitempty"`
 }
 
+// Partial reports whether some shards failed or timed out, so the hits of the
+// response may be incomplete.
+func (r *ESResponse) Partial() bool {
+	return r.TimedOut || r.Shards.Failed > 0
+}
+
 type ESBody struct {
-	Query ESBodyQuery `json:"query"`
-	Size  int         `json:"size,omitempty"`
-	Aggs  M           `json:"aggs,omitempty"`
+	Query       ESBodyQuery       `json:"query"`
+	Size        int               `json:"size,omitempty"`
+	Aggs        M                 `json:"aggs,omitempty"`
+	Sort        []M               `json:"sort,omitempty"`
+	SearchAfter []json.RawMessage `json:"search_after,omitempty"`
+	Pit         *ESBodyPit        `json:"pit,omitempty"`
+	Slice       *ESBodySlice      `json:"slice,omitempty"`
+
+	Source          *ESBodySource `json:"_source,omitempty"`
+	Fields          []any         `json:"fields,omitempty"` // field names or M{"field": ..., "format": ...}
+	DocvalueFields  []any         `json:"docvalue_fields,omitempty"`
+	StoredFields    []string      `json:"stored_fields,omitempty"`
+	RuntimeMappings M             `json:"runtime_mappings,omitempty"`
+}
+
+// ESBodySource filters the _source returned with each hit.
+type ESBodySource struct {
+	Disabled bool     `json:"-"` // return no _source at all
+	Includes []string `json:"includes,omitempty"`
+	Excludes []string `json:"excludes,omitempty"`
+}
+
+func (s ESBodySource) MarshalJSON() ([]byte, error) {
+	if s.Disabled {
+		return []byte("false"), nil
+	}
+	type plain ESBodySource
+	return json.Marshal(plain(s))
+}
+
+// UnmarshalJSON accepts every form of _source: a boolean, a field pattern,
+// a list of them or an includes/excludes object.
+func (s *ESBodySource) UnmarshalJSON(b []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(b, &enabled); err == nil {
+		*s = ESBodySource{Disabled: !enabled}
+		return nil
+	}
+	var include string
+	if err := json.Unmarshal(b, &include); err == nil {
+		*s = ESBodySource{Includes: []string{include}}
+		return nil
+	}
+	var includes []string
+	if err := json.Unmarshal(b, &includes); err == nil {
+		*s = ESBodySource{Includes: includes}
+		return nil
+	}
+	type plain ESBodySource
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+type ESBodySlice struct {
+	ID  int `json:"id"`
+	Max int `json:"max"`
+}
+
+type ESBodyPit struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 func (e *ESBody) SetSize(size int) *ESBody {
@@ -104,6 +209,30 @@ func (e *ESBody) SetQuery(query ESBodyQuery) *ESBody {
 	e.Query = query
 	return e
 }
+func (e *ESBody) SetSource(includes, excludes []string) *ESBody {
+	e.Source = &ESBodySource{Includes: includes, Excludes: excludes}
+	return e
+}
+func (e *ESBody) DisableSource() *ESBody {
+	e.Source = &ESBodySource{Disabled: true}
+	return e
+}
+func (e *ESBody) SetFields(fields ...any) *ESBody {
+	e.Fields = fields
+	return e
+}
+func (e *ESBody) SetDocvalueFields(fields ...any) *ESBody {
+	e.DocvalueFields = fields
+	return e
+}
+func (e *ESBody) SetStoredFields(fields ...string) *ESBody {
+	e.StoredFields = fields
+	return e
+}
+func (e *ESBody) SetRuntimeMappings(mappings M) *ESBody {
+	e.RuntimeMappings = mappings
+	return e
+}
 
 func (e ESBody) String() string {
 	b, _ := json.MarshalIndent(e, "", "  ")
@@ -114,6 +243,34 @@ type ESBodyQuery struct {
 	Bool ESBodyBool `json:"bool"`
 }
 
+// UnmarshalJSON wraps any query other than a plain bool into the must clause
+// of a bool, so filters can still be added to it.
+func (e *ESBodyQuery) UnmarshalJSON(b []byte) error {
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(b, &query); err != nil {
+		return err
+	}
+	if len(query) == 0 {
+		*e = ESBodyQuery{}
+		return nil
+	}
+	if raw, ok := query["bool"]; ok && len(query) == 1 {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var bool ESBodyBool
+		if err := dec.Decode(&bool); err == nil {
+			*e = ESBodyQuery{Bool: bool}
+			return nil
+		}
+	}
+	var must M
+	if err := json.Unmarshal(b, &must); err != nil {
+		return err
+	}
+	*e = ESBodyQuery{Bool: ESBodyBool{Must: []M{must}}}
+	return nil
+}
+
 func (e *ESBodyQuery) AddFilter(filter M) *ESBodyQuery {
 	e.Bool.Filter = append(e.Bool.Filter, filter)
 	return e
@@ -139,10 +296,11 @@ func (e *ESBodyQuery) SetBool(bool ESBodyBool) *ESBodyQuery {
 }
 
 type ESBodyBool struct {
-	Filter  []M `json:"filter,omitempty"`
-	Must    []M `json:"must,omitempty"`
-	MustNot []M `json:"must_not,omitempty"`
-	Should  []M `json:"should,omitempty"`
+	Filter             []M `json:"filter,omitempty"`
+	Must               []M `json:"must,omitempty"`
+	MustNot            []M `json:"must_not,omitempty"`
+	Should             []M `json:"should,omitempty"`
+	MinimumShouldMatch any `json:"minimum_should_match,omitempty"`
 }
 
 func (e *ESBodyBool) String() string {
@@ -171,10 +329,27 @@ func (e *ESBodyBool) String() string {
 	return builder.String()
 }
 
-func marshalBytesBreader(src *ESBody) (*bytes.Reader, error) {
+func marshalBytesBreader(src any) (*bytes.Reader, error) {
 	b, err := json.Marshal(src)
 	if err != nil {
 		return nil, MarshalErr(err)
 	}
 	return bytes.NewReader(b), nil
 }
+
+// unmarshalNumber is json.Unmarshal keeping numbers as json.Number, the way
+// doRequest decodes responses with exact numbers.
+func unmarshalNumber(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// formatDuration formats d as an ES time value, in seconds or, when d is not
+// a whole number of them, in milliseconds rounded up.
+func formatDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", int64(d/time.Second))
+	}
+	return fmt.Sprintf("%dms", int64((d+time.Millisecond-1)/time.Millisecond))
+}
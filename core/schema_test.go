@@ -0,0 +1,62 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Hit_GetValue_Fields(t *testing.T) {
+	var hit Hit
+	err := json.Unmarshal([]byte(`{"_id":"1","_source":{"name":"a","ts":"2024-11-07T00:00:00Z"},`+
+		`"fields":{"ts":["2024-11-07"],"tags":["x","y"],"len":[3]}}`), &hit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := hit.GetHeader()
+	sort.Strings(header)
+	if got := strings.Join(header, ","); got != "len,name,tags,ts" {
+		t.Errorf("GetHeader() = %v, want len,name,tags,ts", got)
+	}
+	value := hit.GetValue()
+	if value["ts"] != "2024-11-07" || value["len"] != 3.0 || len(value["tags"].([]any)) != 2 {
+		t.Errorf("GetValue() = %v", value)
+	}
+}
+
+func Test_ESBody_SourceFiltering(t *testing.T) {
+	body := (&ESBody{}).
+		DisableSource().
+		SetFields("name", M{"field": "ts", "format": "epoch_millis"}).
+		SetStoredFields("_none_")
+	query := newTestQuery(t, WithBody(body))
+	windowed, err := query.UpdateBodyTimeRange(query.startTime, query.endTime)
+	if err != nil {
+		t.Fatalf("UpdateBodyTimeRange() error = %v", err)
+	}
+	b, _ := json.Marshal(windowed)
+	for _, want := range []string{`"_source":false`, `"fields":["name",{"field":"ts","format":"epoch_millis"}]`, `"stored_fields":["_none_"]`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("body %s does not contain %s", b, want)
+		}
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Minute, "60s"},
+		{1500 * time.Millisecond, "1500ms"},
+		{500 * time.Millisecond, "500ms"},
+		{time.Microsecond, "1ms"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_ESClient_ScrollWithConsume_Slices(t *testing.T) {
+	const slices, pageSize = 4, 5
+	var (
+		mu      sync.Mutex
+		pages   = make(map[string]int) // scroll id -> pages served
+		cleared = make(map[string]bool)
+	)
+	page := func(scrollID string, n int) ESResponse {
+		var hits BatchHit
+		for i := range n {
+			hits = append(hits, Hit{ID: fmt.Sprintf("%v-%v-%v", scrollID, pages[scrollID], i)})
+		}
+		pages[scrollID]++
+		return ESResponse{ScrollID: scrollID, Hits: Hits{Hits: hits}}
+	}
+
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/idx/_search":
+			var body ESBody
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Slice == nil || body.Slice.Max != slices {
+				t.Errorf("search body slice = %v, want max %v", body.Slice, slices)
+				return
+			}
+			json.NewEncoder(w).Encode(page(fmt.Sprint("s", body.Slice.ID), pageSize))
+		case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll":
+			scrollID := r.URL.Query().Get("scroll_id")
+			json.NewEncoder(w).Encode(page(scrollID, pageSize*(2-pages[scrollID])))
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/_search/scroll/"):
+			cleared[strings.TrimPrefix(r.URL.Path, "/_search/scroll/")] = true
+			w.Write([]byte(`{"succeeded":true}`))
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+	})
+
+	conf := newTestQuery(t, WithSlices(slices))
+
+	var got int
+	err := cli.ScrollWithConsume(context.TODO(), conf, func(c chan Hit) {
+		for range c {
+			got++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ScrollWithConsume() error = %v", err)
+	}
+	if want := slices * pageSize * 2; got != want {
+		t.Errorf("ScrollWithConsume() got %v hits, want %v", got, want)
+	}
+	for id := range slices {
+		if !cleared[fmt.Sprint("s", id)] {
+			t.Errorf("scroll of slice %v was not cleared", id)
+		}
+	}
+}
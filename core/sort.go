@@ -0,0 +1,162 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type SortField struct {
+	Field        string
+	Order        string // asc or desc, asc if empty
+	Missing      string // _last, _first or a custom value
+	UnmappedType string
+}
+
+func (s SortField) body() M {
+	opt := M{"order": "asc"}
+	if s.Order != "" {
+		opt["order"] = s.Order
+	}
+	if s.Missing != "" {
+		opt["missing"] = s.Missing
+	}
+	if s.UnmappedType != "" {
+		opt["unmapped_type"] = s.UnmappedType
+	}
+	return M{s.Field: opt}
+}
+
+// WithSort sets the sort of the extracted hits. The time field must come
+// first since the time windows follow it, sort it desc to dump newest first.
+// It defaults to the time field asc.
+func WithSort(fields ...SortField) OptFn {
+	return func(c *QueryConfig) {
+		c.sort = fields
+	}
+}
+
+func (q *QueryConfig) verifySort() error {
+	if len(q.sort) == 0 {
+		q.sort = []SortField{{Field: q.timeField, Order: "asc"}}
+	}
+	if q.sort[0].Field != q.timeField {
+		return ESQueryVarifyErr("sort must start with the time field")
+	}
+	for _, s := range q.sort {
+		if s.Order != "" && s.Order != "asc" && s.Order != "desc" {
+			return ESQueryVarifyErr("sort order must be asc or desc")
+		}
+	}
+	return nil
+}
+
+// Descending reports whether the dump walks the time range newest first.
+func (q *QueryConfig) Descending() bool {
+	return len(q.sort) > 0 && q.sort[0].Order == "desc"
+}
+
+func (q *QueryConfig) sortBody() []M {
+	body := make([]M, 0, len(q.sort))
+	for _, s := range q.sort {
+		body = append(body, s.body())
+	}
+	return body
+}
+
+func (q *QueryConfig) sortsBy(field string) bool {
+	for _, s := range q.sort {
+		if s.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// pageSize is the number of hits asked per windowed search.
+func (q *QueryConfig) pageSize() *int {
+	if q.body.Size > 0 {
+		return &q.body.Size
+	}
+	return &q.batchSize
+}
+
+// firstWindow returns the first step of [start, end) in the sort direction.
+func (q *QueryConfig) firstWindow(start, end time.Time) (time.Time, time.Time) {
+	if q.Descending() {
+		return maxTime(end.Add(-q.stepDuration), start), end
+	}
+	return start, minTime(start.Add(q.stepDuration), end)
+}
+
+// nextWindow returns the window to query after [sTime, eTime) returned hits.
+// When the window holds more hits than a page, it shrinks to continue from
+// the last hit, which means hits sharing its timestamp are returned again.
+// Otherwise it steps to the next window in the sort direction.
+func (q *QueryConfig) nextWindow(sTime, eTime time.Time, hits Hits) (time.Time, time.Time, error) {
+	if n := len(hits.Hits); n > 0 && (hits.Total.Relation == "gte" || hits.Total.Value > n) {
+		last, err := q.HitTime(hits.Hits[n-1])
+		if err != nil {
+			return sTime, eTime, err
+		}
+		if q.Descending() {
+			// lt is exclusive, keep the hits sharing the last timestamp
+			last = last.Add(time.Millisecond)
+			if !last.Before(eTime) {
+				return sTime, eTime, errors.Errorf("more than %v hits at %v, use point in time mode", n, last)
+			}
+			return sTime, last, nil
+		}
+		if !last.After(sTime) {
+			return sTime, eTime, errors.Errorf("more than %v hits at %v, use point in time mode", n, last)
+		}
+		return last, eTime, nil
+	}
+	if q.Descending() {
+		return maxTime(sTime.Add(-q.stepDuration), q.startTime), sTime, nil
+	}
+	return eTime, minTime(eTime.Add(q.stepDuration), q.endTime), nil
+}
+
+// HitTime returns the time field value of a hit of the query, from its sort
+// values when possible or else from its source and fields.
+func (q *QueryConfig) HitTime(hit Hit) (time.Time, error) {
+	if len(hit.Sort) > 0 {
+		switch {
+		case q.timeMapping.numeric():
+			var value any
+			if err := json.Unmarshal(hit.Sort[0], &value); err == nil {
+				return q.parseTime(value)
+			}
+		case q.timeMapping.Type == "date_nanos":
+			var nanos int64
+			if err := json.Unmarshal(hit.Sort[0], &nanos); err == nil {
+				return time.Unix(0, nanos), nil
+			}
+		default:
+			if t, ok := hit.SortTime(); ok {
+				return t, nil
+			}
+		}
+	}
+	value, ok := hit.GetValue()[q.timeField]
+	if !ok {
+		return time.Time{}, errors.Errorf("time field %v not found in hit %v", q.timeField, hit.ID)
+	}
+	return q.parseTime(value)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newSortQuery(t *testing.T, order string) *QueryConfig {
+	return newTestQuery(t,
+		WithEndTime(time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC)),
+		WithStepByDay(1),
+		WithSort(SortField{Field: "ts", Order: order}, SortField{Field: "id", Missing: "_last", UnmappedType: "keyword"}),
+	)
+}
+
+func sortHit(ts time.Time) Hit {
+	return Hit{Sort: []json.RawMessage{json.RawMessage(fmt.Sprint(ts.UnixMilli()))}}
+}
+
+func Test_QueryConfig_WithSort(t *testing.T) {
+	_, err := NewQueryConfig(
+		WithIndex("idx"),
+		WithTimeField("ts"),
+		WithStartTime(time.Now().Add(-time.Hour)),
+		WithEndTime(time.Now()),
+		WithBody(&ESBody{}),
+		WithSort(SortField{Field: "id"}),
+	)
+	if err == nil {
+		t.Error("NewQueryConfig() with sort not starting with the time field want error")
+	}
+
+	body, err := newSortQuery(t, "desc").UpdateBodyTimeRange(time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("UpdateBodyTimeRange() error = %v", err)
+	}
+	got, _ := json.Marshal(body.Sort)
+	want := `[{"ts":{"order":"desc"}},{"id":{"missing":"_last","order":"asc","unmapped_type":"keyword"}}]`
+	if string(got) != want {
+		t.Errorf("body sort = %s, want %s", got, want)
+	}
+}
+
+func Test_QueryConfig_nextWindow(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.November, d, 0, 0, 0, 0, time.UTC) }
+	full := func(last time.Time) Hits {
+		var hits Hits
+		hits.Total.Value = 10000
+		hits.Total.Relation = "gte"
+		hits.Hits = BatchHit{sortHit(last.Add(-time.Minute)), sortHit(last)}
+		return hits
+	}
+
+	tests := []struct {
+		name       string
+		order      string
+		start, end time.Time
+		hits       Hits
+		wantStart  time.Time
+		wantEnd    time.Time
+		wantErr    bool
+	}{
+		{"asc step", "asc", day(7), day(8), Hits{}, day(8), day(9), false},
+		{"asc last step", "asc", day(9), day(10), Hits{}, day(10), day(10), false},
+		{"asc overflow", "asc", day(7), day(8), full(day(7).Add(time.Hour)), day(7).Add(time.Hour), day(8), false},
+		{"asc stuck", "asc", day(7), day(8), full(day(7)), day(7), day(8), true},
+		{"desc step", "desc", day(9), day(10), Hits{}, day(8), day(9), false},
+		{"desc last step", "desc", day(7), day(8), Hits{}, day(7), day(7), false},
+		{"desc overflow", "desc", day(9), day(10), full(day(9).Add(time.Hour)), day(9), day(9).Add(time.Hour + time.Millisecond), false},
+		{"desc stuck", "desc", day(9), day(10), full(day(10).Add(-time.Millisecond)), day(9), day(10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSortQuery(t, tt.order)
+			gotStart, gotEnd, err := q.nextWindow(tt.start, tt.end, tt.hits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !gotStart.Equal(tt.wantStart) || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("nextWindow() = [%v, %v), want [%v, %v)", gotStart, gotEnd, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
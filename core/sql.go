@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+var sqlFromRe = regexp.MustCompile(`(?is)\bFROM\s+(?:"([^"]+)"|([^\s,;()]+))`)
+
+// NewSQLQueryConfig builds a query from an ES SQL SELECT statement, translated
+// to the query DSL by the _sql/translate API. The FROM clause gives the index
+// unless WithIndex is passed, ORDER BY must start with the time field if any,
+// and the columns follow the SELECT list. The time field and range are still
+// set by opt. LIMIT is ignored, the whole range is dumped.
+func NewSQLQueryConfig(ctx context.Context, client *ESClient, sql string, opt ...OptFn) (*QueryConfig, error) {
+	bodyReader, err := marshalBytesBreader(M{"query": sql})
+	if err != nil {
+		return nil, err
+	}
+	var dsl struct {
+		Query           *ESBodyQuery    `json:"query"`
+		Source          *ESBodySource   `json:"_source"`
+		Fields          []any           `json:"fields"`
+		DocvalueFields  []any           `json:"docvalue_fields"`
+		StoredFields    json.RawMessage `json:"stored_fields"`
+		RuntimeMappings M               `json:"runtime_mappings"`
+		Sort            []M             `json:"sort"`
+		Aggregations    M               `json:"aggregations"`
+	}
+	if err := client.doInto(ctx, esapi.SQLTranslateRequest{Body: bodyReader}, &dsl); err != nil {
+		return nil, err
+	}
+	if len(dsl.Aggregations) > 0 {
+		return nil, ESQueryVarifyErr("sql with aggregations can not be dumped as hits")
+	}
+
+	body := &ESBody{
+		Source:          dsl.Source,
+		Fields:          dsl.Fields,
+		DocvalueFields:  dsl.DocvalueFields,
+		RuntimeMappings: dsl.RuntimeMappings,
+	}
+	if dsl.Query != nil {
+		body.Query = *dsl.Query
+	}
+	if len(dsl.StoredFields) > 0 {
+		var one string
+		if err := json.Unmarshal(dsl.StoredFields, &one); err == nil {
+			body.StoredFields = []string{one}
+		} else if err := json.Unmarshal(dsl.StoredFields, &body.StoredFields); err != nil {
+			return nil, DecodeErr(err)
+		}
+	}
+	sort, err := sqlSort(dsl.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []OptFn{WithBody(body)}
+	if m := sqlFromRe.FindStringSubmatch(sql); m != nil {
+		opts = append(opts, WithIndices(strings.Split(m[1]+m[2], ",")...))
+	}
+	if len(sort) > 0 {
+		opts = append(opts, WithSort(sort...))
+	}
+	q, err := NewQueryConfig(append(opts, opt...)...)
+	if err != nil {
+		return nil, err
+	}
+	q.columns = sqlColumns(body, sqlSelectFields(sql))
+	return q, nil
+}
+
+// sqlSort converts the translated sort, dropping the _doc sort ES SQL adds
+// when there is no ORDER BY.
+func sqlSort(sort []M) ([]SortField, error) {
+	var fields []SortField
+	for _, s := range sort {
+		for field, v := range s {
+			if field == "_doc" {
+				continue
+			}
+			if strings.HasPrefix(field, "_") && field != "_id" {
+				return nil, ESQueryVarifyErr("sql can only order by fields, not " + field)
+			}
+			opt, _ := v.(map[string]any)
+			sf := SortField{Field: field}
+			sf.Order, _ = opt["order"].(string)
+			sf.Missing, _ = opt["missing"].(string)
+			sf.UnmappedType, _ = opt["unmapped_type"].(string)
+			fields = append(fields, sf)
+		}
+	}
+	return fields, nil
+}
+
+// sqlColumns returns the fields the translated body fetches in the order of
+// the SELECT list, nil when it selects every field. The translation groups
+// them by how they are fetched, so the fields are put back in the order of
+// selected, the others following.
+func sqlColumns(body *ESBody, selected []string) []string {
+	var columns []string
+	add := func(fields []any) {
+		for _, f := range fields {
+			switch f := f.(type) {
+			case string:
+				columns = append(columns, f)
+			case map[string]any:
+				if name, ok := f["field"].(string); ok {
+					columns = append(columns, name)
+				}
+			}
+		}
+	}
+	if body.Source != nil {
+		columns = append(columns, body.Source.Includes...)
+	}
+	add(body.Fields)
+	add(body.DocvalueFields)
+	for _, c := range columns {
+		if strings.Contains(c, "*") {
+			return nil
+		}
+	}
+	ordered := make([]string, 0, len(columns))
+	for _, field := range selected {
+		if slices.Contains(columns, field) && !slices.Contains(ordered, field) {
+			ordered = append(ordered, field)
+		}
+	}
+	for _, c := range columns {
+		if !slices.Contains(ordered, c) {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
+}
+
+// sqlSelectFields returns the fields of the SELECT list of sql in order,
+// leaving out the expressions which are not plain fields.
+func sqlSelectFields(sql string) []string {
+	var items []string
+	depth, start, quote := 0, -1, byte(0)
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth > 0:
+		case start < 0 && sqlKeywordAt(sql, i, "SELECT"):
+			i += len("SELECT") - 1
+			start = i + 1
+		case start >= 0 && c == ',':
+			items = append(items, sql[start:i])
+			start = i + 1
+		case start >= 0 && sqlKeywordAt(sql, i, "FROM"):
+			items = append(items, sql[start:i])
+			return sqlFieldNames(items)
+		}
+	}
+	return nil
+}
+
+// sqlKeywordAt reports whether the keyword kw starts sql at i, as a word.
+func sqlKeywordAt(sql string, i int, kw string) bool {
+	if i+len(kw) > len(sql) || !strings.EqualFold(sql[i:i+len(kw)], kw) {
+		return false
+	}
+	isWord := func(c byte) bool {
+		return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	return (i == 0 || !isWord(sql[i-1])) && (i+len(kw) == len(sql) || !isWord(sql[i+len(kw)]))
+}
+
+var sqlFieldRe = regexp.MustCompile(`^(?:"([^"]+)"|([A-Za-z_@][\w.@]*))(?:\s+(?:AS\s+)?\S+)?$`)
+
+// sqlFieldNames returns the fields the SELECT items read, their aliases left
+// out since the hits hold the fields.
+func sqlFieldNames(items []string) []string {
+	var fields []string
+	for _, item := range items {
+		m := sqlFieldRe.FindStringSubmatch(strings.TrimSpace(item))
+		if m == nil {
+			continue
+		}
+		fields = append(fields, m[1]+m[2])
+	}
+	return fields
+}
+
+// Columns returns the column order asked by the query, nil when it is up to
+// the outputer.
+func (q *QueryConfig) Columns() []string {
+	return q.columns
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_NewSQLQueryConfig(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/_sql/translate" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{
+			"size": 1000,
+			"query": {"term": {"level": {"value": "error"}}},
+			"_source": false,
+			"fields": [{"field": "service"}, {"field": "ts", "format": "strict_date_optional_time_nanos"}, {"field": "message"}],
+			"sort": [{"ts": {"order": "desc", "missing": "_first", "unmapped_type": "date"}}],
+			"track_total_hits": -1
+		}`))
+	})
+
+	q, err := NewSQLQueryConfig(context.TODO(), cli,
+		`SELECT service, ts, message FROM "logs-*" WHERE level = 'error' ORDER BY ts DESC`,
+		WithTimeField("ts"),
+		WithStartTime(time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)),
+		WithEndTime(time.Date(2024, time.November, 8, 0, 0, 0, 0, time.UTC)),
+	)
+	if err != nil {
+		t.Fatalf("NewSQLQueryConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(q.index, []string{"logs-*"}) {
+		t.Errorf("index = %v, want logs-*", q.index)
+	}
+	if !q.Descending() {
+		t.Error("Descending() = false, want ORDER BY ts DESC honored")
+	}
+	if want := []string{"service", "ts", "message"}; !reflect.DeepEqual(q.Columns(), want) {
+		t.Errorf("Columns() = %v, want %v", q.Columns(), want)
+	}
+	got, _ := json.Marshal(q.body.Query.Bool.Must)
+	if want := `[{"term":{"level":{"value":"error"}}}]`; string(got) != want {
+		t.Errorf("query must = %s, want %s", got, want)
+	}
+	if q.body.Source == nil || !q.body.Source.Disabled {
+		t.Errorf("_source = %+v, want disabled", q.body.Source)
+	}
+}
+
+func Test_NewSQLQueryConfig_Count(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_sql/translate":
+			w.Write([]byte(`{
+				"size": 1000,
+				"query": {"term": {"level": {"value": "error"}}},
+				"_source": false,
+				"fields": [{"field": "service"}, {"field": "ts"}],
+				"sort": [{"ts": {"order": "asc"}}],
+				"track_total_hits": -1
+			}`))
+		case "/logs/_count":
+			var body map[string]json.RawMessage
+			json.NewDecoder(r.Body).Decode(&body)
+			if _, ok := body["query"]; !ok || len(body) != 1 {
+				t.Errorf("count body = %v, want the query only", body)
+			}
+			w.Write([]byte(`{"count":7}`))
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+	})
+
+	q, err := NewSQLQueryConfig(context.TODO(), cli,
+		`SELECT service, ts FROM logs WHERE level = 'error' ORDER BY ts`,
+		WithTimeField("ts"), WithStartTime(testStart), WithEndTime(testEnd),
+	)
+	if err != nil {
+		t.Fatalf("NewSQLQueryConfig() error = %v", err)
+	}
+	count, err := cli.Count(context.TODO(), q)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 7 {
+		t.Errorf("Count() = %v, want 7", count)
+	}
+}
+
+func Test_sqlSort(t *testing.T) {
+	sort, err := sqlSort([]M{{"_doc": map[string]any{"order": "asc"}}})
+	if err != nil || len(sort) != 0 {
+		t.Errorf("sqlSort(_doc) = %v, %v, want no sort", sort, err)
+	}
+	if _, err := sqlSort([]M{{"_script": map[string]any{"type": "number"}}}); err == nil {
+		t.Error("sqlSort(_script) want error")
+	}
+}
+
+func Test_sqlColumns(t *testing.T) {
+	tests := []struct {
+		sql  string
+		body *ESBody
+		want []string
+	}{
+		{
+			sql: `SELECT message, ts AS time, "service.name", LENGTH(message) len FROM logs`,
+			body: &ESBody{
+				Source:         &ESBodySource{Includes: []string{"message", "service.name"}},
+				DocvalueFields: []any{map[string]any{"field": "ts"}},
+			},
+			want: []string{"message", "ts", "service.name"},
+		},
+		{
+			sql: `select host, EXTRACT(YEAR FROM ts) y, bytes from "logs-*" where a = 'x, from'`,
+			body: &ESBody{
+				Fields: []any{map[string]any{"field": "bytes"}, map[string]any{"field": "host"}, map[string]any{"field": "ts"}},
+			},
+			want: []string{"host", "bytes", "ts"},
+		},
+		{
+			sql:  `SELECT * FROM logs`,
+			body: &ESBody{Source: &ESBodySource{Includes: []string{"*"}}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := sqlColumns(tt.body, sqlSelectFields(tt.sql)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sqlColumns(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
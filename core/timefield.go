@@ -0,0 +1,439 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+// defaultDateFormat is the format ES gives date fields mapped without one.
+const defaultDateFormat = "strict_date_optional_time||epoch_millis"
+
+// TimeMapping is how the time field is mapped: its type and, for dates, its
+// format, alternatives separated by ||.
+type TimeMapping struct {
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+}
+
+// numeric reports whether the field holds plain epoch numbers instead of dates.
+func (m TimeMapping) numeric() bool {
+	switch m.Type {
+	case "long", "integer", "unsigned_long", "double", "float", "scaled_float":
+		return true
+	}
+	return false
+}
+
+// WithTimeMapping sets how the time field is mapped, as returned by
+// ESClient.TimeMapping.
+func WithTimeMapping(mapping TimeMapping) OptFn {
+	return func(c *QueryConfig) {
+		c.timeMapping = mapping
+	}
+}
+
+// WithTimeFormat sets the ES date format of the time field, e.g. epoch_millis
+// or yyyy-MM-dd HH:mm:ss.
+func WithTimeFormat(format string) OptFn {
+	return func(c *QueryConfig) {
+		c.timeMapping = TimeMapping{Type: "date", Format: format}
+	}
+}
+
+// WithTimeZone sets the time zone of time field values written without one,
+// in the range filters and in the hits. It defaults to UTC. A location without
+// an IANA name, such as time.Local, is sent to ES as its current UTC offset.
+func WithTimeZone(loc *time.Location) OptFn {
+	return func(c *QueryConfig) {
+		c.timeZone = loc
+	}
+}
+
+// SetTimeMapping changes how the time field is mapped and rewrites the time
+// range filter of the body accordingly.
+func (q *QueryConfig) SetTimeMapping(mapping TimeMapping) error {
+	format, err := parseTimeFormat(mapping)
+	if err != nil {
+		return err
+	}
+	q.timeMapping, q.timeFormat = mapping, format
+	q.body.Query.Bool.Filter = q.replaceTimeRange(q.body.Query.Bool.Filter, q.startTime, q.endTime)
+	b, err := json.Marshal(q.body)
+	if err != nil {
+		return MarshalErr(err)
+	}
+	q.BodyBytes = b
+	q.bodyReader = bytes.NewReader(b)
+	return nil
+}
+
+// HasTimeMapping reports whether the time field mapping was set.
+func (q *QueryConfig) HasTimeMapping() bool {
+	return q.timeMapping.Type != ""
+}
+
+// timeRange returns the range filter selecting [start, end) of the time field,
+// written in the format of the field.
+func (q *QueryConfig) timeRange(start, end time.Time) M {
+	rng := M{
+		"gte": q.timeFormat.format(start, q.timeZone),
+		"lt":  q.timeFormat.format(end, q.timeZone),
+	}
+	if q.timeMapping.numeric() {
+		return M{"range": M{q.timeField: rng}}
+	}
+	if q.dateMathPassthrough {
+		// only the bounds of the whole range, inner windows stay absolute
+		if q.startExpr != "" && start.Equal(q.startTime) {
+			rng["gte"] = q.startExpr
+		}
+		if q.endExpr != "" && end.Equal(q.endTime) {
+			rng["lt"] = q.endExpr
+		}
+	}
+	if q.timeFormat.layouts != nil {
+		rng["format"] = q.timeFormat.layouts[0].name
+	}
+	if q.timeZone != nil && (q.timeFormat.layouts == nil || q.timeFormat.layouts[0].epoch == 0) {
+		rng["time_zone"] = esTimeZone(q.timeZone)
+	}
+	return M{"range": M{q.timeField: rng}}
+}
+
+// esTimeZone names loc the way ES understands, by its IANA name or else by
+// its current UTC offset.
+func esTimeZone(loc *time.Location) string {
+	if name := loc.String(); name != "Local" {
+		if _, err := time.LoadLocation(name); err == nil {
+			return name
+		}
+	}
+	return time.Now().In(loc).Format("-07:00")
+}
+
+// replaceTimeRange replaces the range filters on the time field with
+// [start, end), appending one when there is none.
+func (q *QueryConfig) replaceTimeRange(filters []M, start, end time.Time) []M {
+	replaced := make([]M, 0, len(filters)+1)
+	found := false
+	for _, v := range filters {
+		if q.isTimeRange(v) {
+			if !found {
+				replaced = append(replaced, q.timeRange(start, end))
+				found = true
+			}
+			continue
+		}
+		replaced = append(replaced, v)
+	}
+	if !found {
+		replaced = append(replaced, q.timeRange(start, end))
+	}
+	return replaced
+}
+
+// isTimeRange reports whether the clause is a range on the time field.
+func (q *QueryConfig) isTimeRange(clause M) bool {
+	if rng, ok := clause["range"].(map[string]any); ok {
+		clause["range"] = M(rng)
+	}
+	rng, ok := clause["range"].(M)
+	if !ok {
+		return false
+	}
+	_, ok = rng[q.timeField]
+	return ok
+}
+
+// parseTime parses a time field value found in _source or fields.
+func (q *QueryConfig) parseTime(value any) (time.Time, error) {
+	loc := q.timeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	return q.timeFormat.parse(value, loc)
+}
+
+// TimeMapping reads how the time field of the query is mapped in its indices.
+func (e *ESClient) TimeMapping(ctx context.Context, query *QueryConfig) (TimeMapping, error) {
+	var resp map[string]struct {
+		Mappings map[string]struct {
+			Mapping map[string]TimeMapping `json:"mapping"`
+		} `json:"mappings"`
+	}
+	err := e.doInto(ctx, esapi.IndicesGetFieldMappingRequest{
+		Index:             query.index,
+		Fields:            []string{query.timeField},
+		IgnoreUnavailable: query.ignoreUnavailable,
+		AllowNoIndices:    query.allowNoIndices,
+		ExpandWildcards:   query.expandWildcards,
+	}, &resp)
+	if err != nil {
+		return TimeMapping{}, err
+	}
+
+	var found *TimeMapping
+	for index, mappings := range resp {
+		field, ok := mappings.Mappings[query.timeField]
+		if !ok {
+			continue
+		}
+		// the mapping is keyed by the leaf name of the field
+		for _, m := range field.Mapping {
+			if m.Format == "" && !m.numeric() {
+				m.Format = defaultDateFormat
+			}
+			if found == nil {
+				found = &m
+			} else if *found != m {
+				slog.Warn("time field mapped differently across indices",
+					slog.String("index", index), slog.String("type", m.Type), slog.String("format", m.Format))
+			}
+		}
+	}
+	if found == nil {
+		return TimeMapping{}, ESQueryVarifyErr("time field " + query.timeField + " is not mapped")
+	}
+	return *found, nil
+}
+
+// timeFormat parses and formats the values of a time field. Its zero value
+// writes ESDateFormat and reads dates or epoch millis.
+type timeFormat struct {
+	layouts []timeLayout
+}
+
+type timeLayout struct {
+	name   string        // ES name of the format
+	layout string        // Go layout, empty for epoch and optional time formats
+	epoch  time.Duration // unit of epoch formats
+}
+
+func parseTimeFormat(mapping TimeMapping) (timeFormat, error) {
+	if mapping.Type == "" {
+		return timeFormat{}, nil
+	}
+	format := mapping.Format
+	if format == "" {
+		format = defaultDateFormat
+		if mapping.numeric() {
+			format = "epoch_millis"
+		}
+	}
+	var f timeFormat
+	for _, name := range strings.Split(format, "||") {
+		layout, err := esLayout(strings.TrimSpace(name))
+		if err != nil {
+			return timeFormat{}, err
+		}
+		f.layouts = append(f.layouts, layout)
+	}
+	return f, nil
+}
+
+func (f timeFormat) format(t time.Time, loc *time.Location) any {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if f.layouts == nil {
+		// the offset is written, so that ES reads the same instant whatever
+		// the time_zone of the range
+		return t.In(loc).Format("2006-01-02T15:04:05.999Z07:00")
+	}
+	l := f.layouts[0]
+	if l.epoch > 0 {
+		return t.UnixNano() / int64(l.epoch)
+	}
+	if l.layout == "" {
+		return t.In(loc).Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	return t.In(loc).Format(l.layout)
+}
+
+func (f timeFormat) parse(value any, loc *time.Location) (time.Time, error) {
+	layouts := f.layouts
+	if layouts == nil {
+		layouts = defaultLayouts
+	}
+	s, isString := value.(string)
+	if !isString {
+		if _, err := cast.ToFloat64E(value); err != nil {
+			return time.Time{}, errors.Errorf("time value %v is neither a string nor a number", value)
+		}
+		s = cast.ToString(value)
+	}
+	for _, l := range layouts {
+		if l.epoch > 0 {
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return time.Unix(0, int64(n*float64(l.epoch))), nil
+			}
+			continue
+		}
+		if !isString {
+			continue
+		}
+		if l.layout == "" {
+			// date_optional_time accepts any precision
+			for _, layout := range optionalTimeLayouts {
+				if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+					return t, nil
+				}
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(l.layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("time value %v does not match the time format", value)
+}
+
+var defaultLayouts = []timeLayout{
+	{name: "strict_date_optional_time"},
+	{name: "epoch_millis", epoch: time.Millisecond},
+}
+
+var optionalTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02T15Z07:00",
+	"2006-01-02T15",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// namedLayouts are the built in ES formats, without their strict_ prefix.
+var namedLayouts = map[string]string{
+	"date":                             "2006-01-02",
+	"date_hour":                        "2006-01-02T15",
+	"date_hour_minute":                 "2006-01-02T15:04",
+	"date_hour_minute_second":          "2006-01-02T15:04:05",
+	"date_hour_minute_second_millis":   "2006-01-02T15:04:05.000",
+	"date_hour_minute_second_fraction": "2006-01-02T15:04:05.000",
+	"date_time":                        "2006-01-02T15:04:05.000Z07:00",
+	"date_time_no_millis":              "2006-01-02T15:04:05Z07:00",
+	"basic_date":                       "20060102",
+	"basic_date_time":                  "20060102T150405.000Z0700",
+	"basic_date_time_no_millis":        "20060102T150405Z0700",
+	"year_month_day":                   "2006-01-02",
+	"year_month":                       "2006-01",
+	"year":                             "2006",
+}
+
+// esLayout converts an ES date format, built in or Java style pattern, to a
+// Go layout.
+func esLayout(name string) (timeLayout, error) {
+	switch name {
+	case "epoch_millis":
+		return timeLayout{name: name, epoch: time.Millisecond}, nil
+	case "epoch_second":
+		return timeLayout{name: name, epoch: time.Second}, nil
+	}
+	builtin := strings.TrimPrefix(name, "strict_")
+	switch builtin {
+	case "date_optional_time", "date_optional_time_nanos":
+		return timeLayout{name: name}, nil
+	}
+	if layout, ok := namedLayouts[builtin]; ok {
+		return timeLayout{name: name, layout: layout}, nil
+	}
+	layout, err := javaLayout(name)
+	if err != nil {
+		return timeLayout{}, err
+	}
+	return timeLayout{name: name, layout: layout}, nil
+}
+
+// javaLayout converts a Java DateTimeFormatter pattern to a Go layout.
+func javaLayout(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		if c == '\'' {
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return "", errors.Errorf("unterminated quote in time format %q", pattern)
+			}
+			if end == 0 {
+				b.WriteByte('\'')
+			}
+			b.WriteString(pattern[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+		n := 1
+		for i+n < len(pattern) && pattern[i+n] == c {
+			n++
+		}
+		i += n
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			b.WriteString(strings.Repeat(string(c), n))
+			continue
+		}
+		token, ok := javaToken(c, n)
+		if !ok {
+			return "", errors.Errorf("unsupported pattern %q in time format %q", strings.Repeat(string(c), n), pattern)
+		}
+		b.WriteString(token)
+	}
+	return b.String(), nil
+}
+
+func javaToken(c byte, n int) (string, bool) {
+	switch c {
+	case 'y', 'u':
+		if n == 2 {
+			return "06", true
+		}
+		return "2006", true
+	case 'M', 'L':
+		return pick(n, "1", "01", "Jan", "January")
+	case 'd':
+		return pick(n, "2", "02")
+	case 'H', 'k':
+		return "15", n <= 2
+	case 'h', 'K':
+		return pick(n, "3", "03")
+	case 'm':
+		return pick(n, "4", "04")
+	case 's':
+		return pick(n, "5", "05")
+	case 'S':
+		return strings.Repeat("0", n), n <= 9
+	case 'a':
+		return "PM", n == 1
+	case 'E':
+		if n == 4 {
+			return "Monday", true
+		}
+		return "Mon", n <= 3
+	case 'X':
+		return pick(n, "Z07", "Z0700", "Z07:00")
+	case 'x':
+		return pick(n, "-07", "-0700", "-07:00")
+	case 'Z':
+		return pick(n, "-0700", "-0700", "-0700", "", "Z07:00")
+	case 'z':
+		return "MST", n <= 3
+	}
+	return "", false
+}
+
+func pick(n int, tokens ...string) (string, bool) {
+	if n > len(tokens) || tokens[n-1] == "" {
+		return "", false
+	}
+	return tokens[n-1], true
+}
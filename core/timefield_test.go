@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_javaLayout(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"yyyy-MM-dd HH:mm:ss", "2006-01-02 15:04:05"},
+		{"yyyy-MM-dd'T'HH:mm:ss.SSSXXX", "2006-01-02T15:04:05.000Z07:00"},
+		{"dd/MMM/yyyy:HH:mm:ss Z", "02/Jan/2006:15:04:05 -0700"},
+		{"yyyyMMdd", "20060102"},
+	}
+	for _, tt := range tests {
+		got, err := javaLayout(tt.pattern)
+		if err != nil {
+			t.Errorf("javaLayout(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("javaLayout(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+	if _, err := javaLayout("yyyy-MM-dd QQQ"); err == nil {
+		t.Error("javaLayout() with unsupported pattern want error")
+	}
+}
+
+func Test_QueryConfig_TimeFormat(t *testing.T) {
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+	start := time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		opts    []OptFn
+		value   any
+		wantRng string
+	}{
+		{
+			name:    "default",
+			value:   "2024-11-07T08:00:00.000Z",
+			wantRng: `{"gte":"2024-11-07T00:00:00Z","lt":"2024-11-08T00:00:00Z"}`,
+		},
+		{
+			name:    "epoch millis",
+			opts:    []OptFn{WithTimeFormat("epoch_millis")},
+			value:   float64(1730966400000),
+			wantRng: `{"format":"epoch_millis","gte":1730937600000,"lt":1731024000000}`,
+		},
+		{
+			name:    "epoch second long",
+			opts:    []OptFn{WithTimeMapping(TimeMapping{Type: "long", Format: "epoch_second"})},
+			value:   json.Number("1730966400"),
+			wantRng: `{"gte":1730937600,"lt":1731024000}`,
+		},
+		{
+			name:    "custom pattern in time zone",
+			opts:    []OptFn{WithTimeFormat("yyyy-MM-dd HH:mm:ss||epoch_millis"), WithTimeZone(shanghai)},
+			value:   "2024-11-07 16:00:00",
+			wantRng: `{"format":"yyyy-MM-dd HH:mm:ss","gte":"2024-11-07 08:00:00","lt":"2024-11-08 08:00:00","time_zone":"Asia/Shanghai"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQueryConfig(append([]OptFn{
+				WithIndex("idx"),
+				WithTimeField("ts"),
+				WithStartTime(start),
+				WithEndTime(end),
+				WithBody(&ESBody{}),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("NewQueryConfig() error = %v", err)
+			}
+			body, err := q.UpdateBodyTimeRange(start, end)
+			if err != nil {
+				t.Fatalf("UpdateBodyTimeRange() error = %v", err)
+			}
+			if len(body.Query.Bool.Filter) != 1 {
+				t.Fatalf("filters = %v, want one range", body.Query.Bool.Filter)
+			}
+			rng, _ := json.Marshal(body.Query.Bool.Filter[0]["range"].(M)["ts"])
+			if string(rng) != tt.wantRng {
+				t.Errorf("range = %s, want %s", rng, tt.wantRng)
+			}
+
+			// no sort values, so the time comes from the source
+			got, err := q.HitTime(Hit{ID: "1", Source: M{"ts": tt.value}})
+			if err != nil {
+				t.Fatalf("HitTime() error = %v", err)
+			}
+			if want := start.Add(8 * time.Hour); !got.Equal(want) {
+				t.Errorf("HitTime() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_timeFormat_formatUnmapped(t *testing.T) {
+	// without a mapping, times are sent with their offset in the time zone
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+	at := time.Date(2024, time.November, 7, 8, 0, 0, 0, shanghai)
+	tests := []struct {
+		loc  *time.Location
+		want string
+	}{
+		{nil, "2024-11-07T00:00:00Z"},
+		{shanghai, "2024-11-07T08:00:00+08:00"},
+	}
+	for _, tt := range tests {
+		if got := (timeFormat{}).format(at, tt.loc); got != tt.want {
+			t.Errorf("format(%v) = %v, want %v", tt.loc, got, tt.want)
+		}
+	}
+}
+
+func Test_ESClient_TimeMapping(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs-*/_mapping/field/event.created" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{
+			"logs-a": {"mappings": {"event.created": {"full_name": "event.created", "mapping": {"created": {"type": "date", "format": "yyyy-MM-dd HH:mm:ss"}}}}},
+			"logs-b": {"mappings": {}}
+		}`))
+	})
+	query, err := NewQueryConfig(
+		WithIndex("logs-*"),
+		WithTimeField("event.created"),
+		WithStartTime(time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)),
+		WithEndTime(time.Date(2024, time.November, 8, 0, 0, 0, 0, time.UTC)),
+		WithBody(&ESBody{}),
+	)
+	if err != nil {
+		t.Fatalf("NewQueryConfig() error = %v", err)
+	}
+	mapping, err := cli.TimeMapping(context.TODO(), query)
+	if err != nil {
+		t.Fatalf("TimeMapping() error = %v", err)
+	}
+	if mapping != (TimeMapping{Type: "date", Format: "yyyy-MM-dd HH:mm:ss"}) {
+		t.Errorf("TimeMapping() = %+v", mapping)
+	}
+	if err := query.SetTimeMapping(mapping); err != nil {
+		t.Fatalf("SetTimeMapping() error = %v", err)
+	}
+	want := `{"query":{"bool":{"filter":[{"range":{"event.created":{"format":"yyyy-MM-dd HH:mm:ss","gte":"2024-11-07 00:00:00","lt":"2024-11-08 00:00:00"}}}]}}}`
+	if string(query.BodyBytes) != want {
+		t.Errorf("BodyBytes = %s, want %s", query.BodyBytes, want)
+	}
+}
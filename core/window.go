@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SplitByStep cuts [start, end) into consecutive windows of at most step.
+func SplitByStep(start, end time.Time, step time.Duration) []TimeWindow {
+	if step <= 0 {
+		return []TimeWindow{{Start: start, End: end}}
+	}
+	var windows []TimeWindow
+	for sTime := start; sTime.Before(end); sTime = sTime.Add(step) {
+		eTime := sTime.Add(step)
+		if eTime.After(end) {
+			eTime = end
+		}
+		windows = append(windows, TimeWindow{Start: sTime, End: eTime})
+	}
+	return windows
+}
+
+// SplitByHistogram runs a date_histogram with the given interval over the
+// query and groups adjacent buckets into at most parts windows holding
+// roughly the same number of documents.
+func (e *ESClient) SplitByHistogram(ctx context.Context, query *QueryConfig, interval time.Duration, parts int) ([]TimeWindow, error) {
+	body, err := query.UpdateBodyTimeRange(query.startTime, query.endTime)
+	if err != nil {
+		return nil, err
+	}
+	body.Size = 0
+	body.Aggs = M{
+		"windows": M{
+			"date_histogram": M{
+				"field":          query.timeField,
+				"fixed_interval": formatDuration(interval),
+			},
+		},
+	}
+	bodyReader, err := marshalBytesBreader(body)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	req := query.searchRequest(bodyReader)
+	req.Size = &size
+	resp, err := e.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	agg, _ := resp.Aggregations["windows"].(map[string]any)
+	buckets, _ := agg["buckets"].([]any)
+	var (
+		counts = make([]int64, 0, len(buckets))
+		keys   = make([]time.Time, 0, len(buckets))
+		total  int64
+	)
+	for _, b := range buckets {
+		bucket, _ := b.(map[string]any)
+		key, err := cast.ToInt64E(bucket["key"])
+		if err != nil {
+			return nil, DecodeErr(err)
+		}
+		count := cast.ToInt64(bucket["doc_count"])
+		keys = append(keys, time.UnixMilli(key))
+		counts = append(counts, count)
+		total += count
+	}
+	return groupBuckets(query.startTime, query.endTime, keys, counts, total, interval, parts), nil
+}
+
+func groupBuckets(start, end time.Time, keys []time.Time, counts []int64, total int64, interval time.Duration, parts int) []TimeWindow {
+	if total == 0 || parts <= 1 {
+		return []TimeWindow{{Start: start, End: end}}
+	}
+	var (
+		windows []TimeWindow
+		target  = (total + int64(parts) - 1) / int64(parts)
+		sTime   = start
+		acc     int64
+	)
+	for n, key := range keys {
+		acc += counts[n]
+		eTime := key.Add(interval)
+		if acc < target || !eTime.After(sTime) || !eTime.Before(end) {
+			continue
+		}
+		windows = append(windows, TimeWindow{Start: sTime, End: eTime})
+		sTime, acc = eTime, 0
+	}
+	return append(windows, TimeWindow{Start: sTime, End: end})
+}
+
+// Window returns a copy of the query restricted to [start, end).
+func (q *QueryConfig) Window(start, end time.Time) (*QueryConfig, error) {
+	body, err := q.UpdateBodyTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, MarshalErr(err)
+	}
+	nq := *q
+	nq.body = body
+	if !start.Equal(q.startTime) {
+		nq.startExpr = ""
+	}
+	if !end.Equal(q.endTime) {
+		nq.endExpr = ""
+	}
+	nq.startTime = start
+	nq.endTime = end
+	nq.BodyBytes = b
+	nq.bodyReader = bytes.NewReader(b)
+	if nq.stepByDay == 0 {
+		nq.stepDuration = end.Sub(start)
+	}
+	return &nq, nil
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_SplitByStep(t *testing.T) {
+	start := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(50 * time.Hour)
+	windows := SplitByStep(start, end, 24*time.Hour)
+	if len(windows) != 3 {
+		t.Fatalf("SplitByStep() got %v windows, want 3", len(windows))
+	}
+	if !windows[0].Start.Equal(start) || !windows[2].End.Equal(end) {
+		t.Errorf("SplitByStep() = %v, want to cover %v ~ %v", windows, start, end)
+	}
+	for n := 1; n < len(windows); n++ {
+		if !windows[n].Start.Equal(windows[n-1].End) {
+			t.Errorf("SplitByStep() window %v starts at %v, want %v", n, windows[n].Start, windows[n-1].End)
+		}
+	}
+}
+
+func Test_groupBuckets(t *testing.T) {
+	start := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(6 * time.Hour)
+	var keys []time.Time
+	for n := range 6 {
+		keys = append(keys, start.Add(time.Duration(n)*time.Hour))
+	}
+	counts := []int64{100, 0, 0, 50, 50, 100}
+
+	windows := groupBuckets(start, end, keys, counts, 300, time.Hour, 3)
+	want := []TimeWindow{
+		{Start: start, End: start.Add(time.Hour)},
+		{Start: start.Add(time.Hour), End: start.Add(5 * time.Hour)},
+		{Start: start.Add(5 * time.Hour), End: end},
+	}
+	if fmt.Sprint(windows) != fmt.Sprint(want) {
+		t.Errorf("groupBuckets() = %v, want %v", windows, want)
+	}
+}
+
+func Test_ParallelIterator_Ordered(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body ESBody
+		json.NewDecoder(r.Body).Decode(&body)
+		rng := body.Query.Bool.Filter[0]["range"].(map[string]any)["ts"].(map[string]any)
+		hits := BatchHit{
+			{ID: fmt.Sprint(rng["gte"], "#0")},
+			{ID: fmt.Sprint(rng["gte"], "#1")},
+		}
+		json.NewEncoder(w).Encode(ESResponse{Hits: Hits{Hits: hits}})
+	})
+
+	start := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	query := newTestQuery(t, WithStartTime(start), WithEndTime(start.Add(5*24*time.Hour)))
+	var queries []*QueryConfig
+	for _, w := range SplitByStep(query.startTime, query.endTime, 24*time.Hour) {
+		q, err := query.Window(w.Start, w.End)
+		if err != nil {
+			t.Fatalf("QueryConfig.Window() error = %v", err)
+		}
+		queries = append(queries, q)
+	}
+
+	iter := NewParallelIterator(context.TODO(), cli, queries, 3, true)
+	var got []string
+	for iter.Next() {
+		got = append(got, iter.Value().ID)
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("ParallelIterator.Err() = %v", err)
+	}
+	if len(got) != 10 {
+		t.Fatalf("ParallelIterator got %v hits, want 10", len(got))
+	}
+	for n := 1; n < len(got); n++ {
+		if got[n] < got[n-1] {
+			t.Errorf("ParallelIterator out of order: %v before %v", got[n-1], got[n])
+		}
+	}
+}
+
+func Test_ParallelIterator_Cancel(t *testing.T) {
+	cli := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		hits := make(BatchHit, 10)
+		json.NewEncoder(w).Encode(ESResponse{Hits: Hits{Hits: hits}})
+	})
+	query := newTestQuery(t)
+	var queries []*QueryConfig
+	for _, w := range SplitByStep(query.startTime, query.endTime, time.Hour) {
+		q, err := query.Window(w.Start, w.End)
+		if err != nil {
+			t.Fatalf("QueryConfig.Window() error = %v", err)
+		}
+		queries = append(queries, q)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	iter := NewParallelIterator(ctx, cli, queries, 3, true)
+	if !iter.Next() {
+		t.Fatalf("Next() = false, err %v", iter.Err())
+	}
+	cancel()
+	for iter.Next() {
+	}
+	if err := iter.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() after cancel = %v, want %v", err, context.Canceled)
+	}
+}
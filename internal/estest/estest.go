@@ -0,0 +1,91 @@
+// Package estest fakes an Elasticsearch cluster for the tests of the other
+// packages.
+package estest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// NewServer starts a fake cluster which answers the product check itself and
+// hands every other request to handler.
+func NewServer(t testing.TB, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// BulkItem is one document of a _bulk request.
+type BulkItem struct {
+	Action  string
+	Index   string
+	ID      string
+	Routing string
+	Source  string
+}
+
+// BulkResult is what the fake cluster answers for a BulkItem, a 201 when
+// Status is 0.
+type BulkResult struct {
+	Status int
+	Type   string // error type, if the item failed
+	Reason string
+}
+
+// BulkHandler answers _bulk requests with the result fn gives each item.
+func BulkHandler(t testing.TB, fn func(item BulkItem) BulkResult) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+			return
+		}
+		var (
+			results []string
+			errors  bool
+		)
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]struct {
+				Index   string `json:"_index"`
+				ID      string `json:"_id"`
+				Routing string `json:"routing"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Errorf("bad bulk action %s: %v", scanner.Bytes(), err)
+				return
+			}
+			var item BulkItem
+			for name, meta := range action {
+				item = BulkItem{Action: name, Index: meta.Index, ID: meta.ID, Routing: meta.Routing}
+			}
+			scanner.Scan()
+			item.Source = scanner.Text()
+
+			result := fn(item)
+			if result.Status == 0 {
+				result.Status = http.StatusCreated
+			}
+			body := fmt.Sprintf(`"_index":%q,"_id":%q,"status":%v`, item.Index, item.ID, result.Status)
+			if result.Type != "" {
+				errors = true
+				body += fmt.Sprintf(`,"error":{"type":%q,"reason":%q}`, result.Type, result.Reason)
+			}
+			results = append(results, fmt.Sprintf(`{%q:{%s}}`, item.Action, body))
+		}
+		fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, errors, strings.Join(results, ","))
+	}
+}
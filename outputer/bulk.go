@@ -0,0 +1,145 @@
+package outputer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// bulkOutputer writes hits in the _bulk format, an index action line followed
+// by the source line, so that the dump can be loaded back as is.
+type bulkOutputer struct {
+	path    string
+	rename  func(index string) string
+	maxSize int64
+	files   []string
+	size    int64
+	f       *os.File
+	w       *bufio.Writer
+	buf     bytes.Buffer
+	enc     *json.Encoder
+}
+
+type BulkOption func(*bulkOutputer)
+
+// WithTargetIndex writes every hit to index instead of the index it came from.
+func WithTargetIndex(index string) BulkOption {
+	return WithIndexRewrite(func(string) string { return index })
+}
+
+// WithIndexRewrite maps the index of each hit to the index it is written to.
+func WithIndexRewrite(rename func(index string) string) BulkOption {
+	return func(o *bulkOutputer) {
+		o.rename = rename
+	}
+}
+
+// WithMaxFileSize splits the output into files of at most size bytes, to keep
+// each of them under the http.max_content_length of the target cluster,
+// 100mb by default. The files are then named dump.00000.ndjson,
+// dump.00001.ndjson and so on after a path of dump.ndjson. A single document
+// bigger than size gets a file of its own.
+func WithMaxFileSize(size int64) BulkOption {
+	return func(o *bulkOutputer) {
+		o.maxSize = size
+	}
+}
+
+func NewBulk(path string, opts ...BulkOption) *bulkOutputer {
+	o := &bulkOutputer{path: path}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.enc = json.NewEncoder(&o.buf)
+	o.enc.SetEscapeHTML(false)
+	return o
+}
+
+// Files returns the files written so far, in order.
+func (o *bulkOutputer) Files() []string {
+	return o.files
+}
+
+func (o *bulkOutputer) Init() error {
+	return o.open()
+}
+
+func (o *bulkOutputer) open() error {
+	path := o.path
+	if o.maxSize > 0 {
+		ext := filepath.Ext(o.path)
+		path = fmt.Sprintf("%s.%05d%s", strings.TrimSuffix(o.path, ext), len(o.files), ext)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	o.f, o.w, o.size = f, bufio.NewWriter(f), 0
+	o.files = append(o.files, path)
+	return nil
+}
+
+func (o *bulkOutputer) Close() (err error) {
+	if o.w != nil {
+		err = o.w.Flush()
+	}
+	if o.f != nil {
+		err = errors.Join(err, o.f.Close())
+	}
+	o.f, o.w = nil, nil
+	return err
+}
+
+func (o *bulkOutputer) Load(batch []core.Hit) (int, error) {
+	if o.f == nil {
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+	for n, hit := range batch {
+		if err := o.encode(hit); err != nil {
+			return n, err
+		}
+		if o.maxSize > 0 && o.size > 0 && o.size+int64(o.buf.Len()) > o.maxSize {
+			if err := o.Close(); err != nil {
+				return n, err
+			}
+			if err := o.open(); err != nil {
+				return n, err
+			}
+		}
+		written, err := o.w.Write(o.buf.Bytes())
+		o.size += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return len(batch), nil
+}
+
+// encode puts the action and source lines of the hit in buf.
+func (o *bulkOutputer) encode(hit core.Hit) error {
+	if hit.Source == nil {
+		return fmt.Errorf("hit %v of %v has no _source to write", hit.ID, hit.Index)
+	}
+	index := hit.Index
+	if o.rename != nil {
+		index = o.rename(index)
+	}
+	meta := core.M{"_index": index, "_id": hit.ID}
+	if hit.Routing != "" {
+		meta["routing"] = hit.Routing
+	}
+	o.buf.Reset()
+	if err := o.enc.Encode(core.M{"index": meta}); err != nil {
+		return err
+	}
+	return o.enc.Encode(hit.Source)
+}
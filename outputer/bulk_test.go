@@ -0,0 +1,54 @@
+package outputer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func Test_bulkOutputer_Load(t *testing.T) {
+	dir := t.TempDir()
+
+	o := NewBulk(filepath.Join(dir, "dump.ndjson"),
+		WithIndexRewrite(func(index string) string { return strings.Replace(index, "logs", "restored", 1) }),
+		WithMaxFileSize(140),
+	)
+	if err := o.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	batch := []core.Hit{
+		{ID: "1", Index: "logs-1", Routing: "u1", Source: core.M{"name": "test1"}},
+		{ID: "2", Index: "logs-1", Source: core.M{"name": "test2"}},
+		{ID: "3", Index: "logs-2", Source: core.M{"name": "test3"}},
+	}
+	if got, err := o.Load(batch); err != nil || got != len(batch) {
+		t.Fatalf("Load() = %v, %v", got, err)
+	}
+	if _, err := o.Load([]core.Hit{{ID: "4", Index: "logs-2"}}); err == nil {
+		t.Error("Load() of a hit without _source succeeded")
+	}
+	o.Close()
+
+	wantFiles := []string{filepath.Join(dir, "dump.00000.ndjson"), filepath.Join(dir, "dump.00001.ndjson")}
+	if !reflect.DeepEqual(o.Files(), wantFiles) {
+		t.Fatalf("Files() = %v, want %v", o.Files(), wantFiles)
+	}
+	want := []string{
+		`{"index":{"_id":"1","_index":"restored-1","routing":"u1"}}` + "\n" + `{"name":"test1"}` + "\n" +
+			`{"index":{"_id":"2","_index":"restored-1"}}` + "\n" + `{"name":"test2"}` + "\n",
+		`{"index":{"_id":"3","_index":"restored-2"}}` + "\n" + `{"name":"test3"}` + "\n",
+	}
+	for n, path := range wantFiles {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want[n] {
+			t.Errorf("file %v = %s, want %s", n, got, want[n])
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -19,10 +20,11 @@ type Tablur interface {
 }
 
 type csvOutputer[T Tablur] struct {
-	path   string
-	header []string
-	writer *csv.Writer
-	f      *os.File
+	path    string
+	header  []string
+	columns []string // set by SetHeader
+	writer  *csv.Writer
+	f       *os.File
 }
 
 func NewCSV[T Tablur](path string) *csvOutputer[T] {
@@ -54,9 +56,56 @@ func (o *csvOutputer[T]) Close() (err error) {
 	return err
 }
 
+func (o *csvOutputer[T]) Offset() (int64, error) {
+	if o.writer == nil || o.f == nil {
+		return 0, nil
+	}
+	o.writer.Flush()
+	if err := o.writer.Error(); err != nil {
+		return 0, err
+	}
+	return o.f.Seek(0, io.SeekCurrent)
+}
+
+func (o *csvOutputer[T]) Resume(offset int64) error {
+	var err error
+	if o.f, err = os.OpenFile(o.path, os.O_RDWR, 0o644); err != nil {
+		return err
+	}
+	header, err := csv.NewReader(o.f).Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if offset > 0 {
+		o.header = header
+	}
+	if err := o.f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := o.f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	o.writer = csv.NewWriter(bufio.NewWriter(o.f))
+	return nil
+}
+
+// SetHeader fixes the columns and their order.
+func (o *csvOutputer[T]) SetHeader(header []string) {
+	o.columns = header
+}
+
+// SetSchema takes the columns from the mapping.
+func (o *csvOutputer[T]) SetSchema(schema core.Schema) {
+	o.columns = schema.Names()
+}
+
 func (o *csvOutputer[T]) initHeader(header []string) error {
+	if o.columns != nil {
+		header = o.columns
+	} else {
+		sort.Strings(header)
+	}
 	o.header = header
-	sort.Strings(o.header)
 	return o.writer.Write(o.header)
 }
 
@@ -99,7 +148,7 @@ func (o *csvOutputer[T]) Load(batch []T) (int, error) {
 		row := v.GetValue()
 		value := make([]string, 0)
 		for _, col := range o.header {
-			val, ok := row[col]
+			val, ok := lookup(row, col)
 			if !ok {
 				value = append(value, "")
 				continue
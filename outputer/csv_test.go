@@ -0,0 +1,95 @@
+package outputer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func Test_csvOutputer_Resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.csv")
+
+	o := NewCSV[core.Hit](path)
+	if err := o.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if _, err := o.Load([]core.Hit{{Source: core.M{"name": "test1", "age": 31}}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	offset, err := o.Offset()
+	if err != nil {
+		t.Fatalf("Offset() error = %v", err)
+	}
+	// rows written after the checkpoint are dropped on resume
+	if _, err := o.Load([]core.Hit{{Source: core.M{"name": "lost", "age": 0}}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	o.Close()
+
+	o = NewCSV[core.Hit](path)
+	if err := o.Resume(offset); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if _, err := o.Load([]core.Hit{{Source: core.M{"name": "test2", "age": 32}}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	o.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "age,name\n31,test1\n32,test2\n"; string(got) != want {
+		t.Errorf("resumed csv = %q, want %q", got, want)
+	}
+}
+
+func Test_csvOutputer_SetHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.csv")
+
+	o := NewCSV[core.Hit](path)
+	o.SetHeader([]string{"name", "missing", "age"})
+	if err := o.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if _, err := o.Load([]core.Hit{{Source: core.M{"name": "test1", "age": 31, "extra": true}}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	o.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,missing,age\ntest1,,31\n"; string(got) != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+}
+
+func Test_csvOutputer_SetSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.csv")
+
+	o := NewCSV[core.Hit](path)
+	o.SetSchema(core.Schema{{Name: "tags.key", Nested: true}, {Name: "user.name"}})
+	if err := o.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	source := core.M{
+		"user": map[string]any{"name": "test1"},
+		"tags": []any{map[string]any{"key": "a"}, map[string]any{"key": "b"}},
+	}
+	if _, err := o.Load([]core.Hit{{Source: source}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	o.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "tags.key,user.name\n\"[\"\"a\"\"，\"\"b\"\"]\",test1\n"; string(got) != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package outputer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// ndjsonOutputer writes one JSON object per hit and per line, keeping nested
+// objects, arrays, numbers and booleans as ES returned them. Longs beyond
+// 2^53 need a client with exact numbers, see core.ClientConfig.
+type ndjsonOutputer struct {
+	path      string
+	withID    bool
+	withIndex bool
+	withSort  bool
+	f         *os.File
+	w         *bufio.Writer
+	enc       *json.Encoder
+}
+
+type NDJSONOption func(*ndjsonOutputer)
+
+// WithID adds the _id of the hit to each line.
+func WithID() NDJSONOption {
+	return func(o *ndjsonOutputer) {
+		o.withID = true
+	}
+}
+
+// WithIndex adds the _index of the hit to each line.
+func WithIndex() NDJSONOption {
+	return func(o *ndjsonOutputer) {
+		o.withIndex = true
+	}
+}
+
+// WithSortValues adds the sort values of the hit to each line, as _sort.
+func WithSortValues() NDJSONOption {
+	return func(o *ndjsonOutputer) {
+		o.withSort = true
+	}
+}
+
+func NewNDJSON(path string, opts ...NDJSONOption) *ndjsonOutputer {
+	o := &ndjsonOutputer{path: path}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *ndjsonOutputer) Init() error {
+	var err error
+	if o.f, err = os.Create(o.path); err != nil {
+		return err
+	}
+	o.initWriter()
+	return nil
+}
+
+func (o *ndjsonOutputer) initWriter() {
+	o.w = bufio.NewWriter(o.f)
+	o.enc = json.NewEncoder(o.w)
+	o.enc.SetEscapeHTML(false)
+}
+
+func (o *ndjsonOutputer) Close() (err error) {
+	if o.w != nil {
+		err = o.w.Flush()
+	}
+	if o.f != nil {
+		err = errors.Join(err, o.f.Close())
+	}
+	return err
+}
+
+func (o *ndjsonOutputer) Offset() (int64, error) {
+	if o.w == nil || o.f == nil {
+		return 0, nil
+	}
+	if err := o.w.Flush(); err != nil {
+		return 0, err
+	}
+	return o.f.Seek(0, io.SeekCurrent)
+}
+
+func (o *ndjsonOutputer) Resume(offset int64) error {
+	var err error
+	if o.f, err = os.OpenFile(o.path, os.O_RDWR, 0o644); err != nil {
+		return err
+	}
+	if err := o.f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := o.f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	o.initWriter()
+	return nil
+}
+
+func (o *ndjsonOutputer) Load(batch []core.Hit) (int, error) {
+	if o.w == nil || o.f == nil {
+		if err := o.Init(); err != nil {
+			return 0, err
+		}
+	}
+	for n, hit := range batch {
+		if err := o.enc.Encode(o.line(hit)); err != nil {
+			return n, err
+		}
+	}
+	return len(batch), nil
+}
+
+// line returns the object written for the hit: its source merged with the
+// requested fields, plus the metadata asked for.
+func (o *ndjsonOutputer) line(hit core.Hit) core.M {
+	value := hit.GetValue()
+	if !o.withID && !o.withIndex && !o.withSort {
+		if value == nil {
+			return core.M{}
+		}
+		return value
+	}
+	line := make(core.M, len(value)+3)
+	for k, v := range value {
+		line[k] = v
+	}
+	if o.withID {
+		line["_id"] = hit.ID
+	}
+	if o.withIndex {
+		line["_index"] = hit.Index
+	}
+	if o.withSort && hit.Sort != nil {
+		line["_sort"] = hit.Sort
+	}
+	return line
+}
@@ -0,0 +1,44 @@
+package outputer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func Test_ndjsonOutputer_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.ndjson")
+
+	var source core.M
+	dec := json.NewDecoder(strings.NewReader(`{"id":9007199254740993,"ratio":0.1,"ok":true,"tags":["a","<b>"],"user":{"name":"x","age":null}}`))
+	dec.UseNumber()
+	if err := dec.Decode(&source); err != nil {
+		t.Fatal(err)
+	}
+	o := NewNDJSON(path, WithID(), WithSortValues())
+	if err := o.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	batch := []core.Hit{
+		{ID: "1", Index: "logs", Source: source, Sort: []json.RawMessage{json.RawMessage(`1730937600000`), json.RawMessage(`"1"`)}},
+		{ID: "2", Index: "logs", Source: core.M{}},
+	}
+	if got, err := o.Load(batch); err != nil || got != len(batch) {
+		t.Fatalf("Load() = %v, %v", got, err)
+	}
+	o.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_id":"1","_sort":[1730937600000,"1"],"id":9007199254740993,"ok":true,"ratio":0.1,"tags":["a","<b>"],"user":{"age":null,"name":"x"}}` + "\n" +
+		`{"_id":"2"}` + "\n"
+	if string(got) != want {
+		t.Errorf("ndjson = %s, want %s", got, want)
+	}
+}
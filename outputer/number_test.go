@@ -0,0 +1,103 @@
+package outputer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/internal/estest"
+	"github.com/xuri/excelize/v2"
+)
+
+// bigID is a long which a float64 can't hold.
+const bigID = "9007199254740993"
+
+// searchHits returns the hits a fake cluster serves through a client with
+// exact numbers, one per source.
+func searchHits(t *testing.T, sources ...string) []core.Hit {
+	t.Helper()
+	srv := estest.NewServer(t, func(w http.ResponseWriter, r *http.Request) {
+		hits := make([]string, len(sources))
+		for n, source := range sources {
+			hits[n] = fmt.Sprintf(`{"_id":"%v","_index":"idx","_source":%v}`, n, source)
+		}
+		fmt.Fprintf(w, `{"hits":{"total":{"value":%v},"hits":[%v]}}`, len(hits), strings.Join(hits, ","))
+	})
+	cli, err := core.NewClientWithConfig(core.ClientConfig{Addresses: []string{srv.URL}, ChanSize: 20, ExactNumbers: true})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	start := time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)
+	query, err := core.NewQueryConfig(
+		core.WithIndex("idx"),
+		core.WithTimeField("ts"),
+		core.WithStartTime(start),
+		core.WithEndTime(start.Add(24*time.Hour)),
+		core.WithBody(&core.ESBody{}),
+	)
+	if err != nil {
+		t.Fatalf("NewQueryConfig() error = %v", err)
+	}
+	var got []core.Hit
+	iter := core.NewQueryIterator(context.TODO(), cli, query)
+	for iter.Next() {
+		got = append(got, iter.Value())
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("QueryIterator.Err() = %v", err)
+	}
+	return got
+}
+
+func Test_Outputers_ExactNumbers(t *testing.T) {
+	hits := searchHits(t, `{"id":`+bigID+`,"ratio":0.1}`)
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "dump.csv")
+	csv := NewCSV[core.Hit](csvPath)
+	csv.SetHeader([]string{"id", "ratio"})
+	ndjsonPath := filepath.Join(dir, "dump.ndjson")
+	ndjson := NewNDJSON(ndjsonPath)
+	xlsxPath := filepath.Join(dir, "dump.xlsx")
+	xlsx := NewXLSX[core.Hit](xlsxPath)
+	xlsx.SetSchema(core.Schema{{Name: "id", Type: "long"}, {Name: "ratio", Type: "double"}})
+	for _, o := range []Outputer[core.Hit]{csv, ndjson, xlsx} {
+		if err := o.Init(); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		if _, err := o.Load(hits); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if err := o.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		csvPath:    bigID + ",0.1",
+		ndjsonPath: `"id":` + bigID,
+	} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%v = %s, want %v", filepath.Base(path), b, want)
+		}
+	}
+
+	f, err := excelize.OpenFile(xlsxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := f.GetCellValue("Sheet1", "A2"); got != bigID {
+		t.Errorf("xlsx id = %v, want %v", got, bigID)
+	}
+}
@@ -1,6 +1,8 @@
 package outputer
 
 import (
+	"strings"
+
 	"github.com/TCP404/esdumpcore/core"
 )
 
@@ -10,5 +12,81 @@ type Outputer[L any] interface {
 	Close() error
 }
 
+// Resumable is implemented by outputers which can continue a file written by
+// an interrupted dump.
+type Resumable interface {
+	// Offset flushes buffered rows and returns the size of the output so far.
+	Offset() (int64, error)
+	// Resume reopens the output truncated to offset instead of Init.
+	Resume(offset int64) error
+}
+
+// Headered is implemented by outputers whose columns can be set before the
+// first batch, instead of taken from the first hit in sorted order.
+type Headered interface {
+	SetHeader(header []string)
+}
+
+// Schemed is implemented by outputers which take their columns, and the type
+// of each of them, from the mapping.
+type Schemed interface {
+	SetSchema(schema core.Schema)
+}
+
+// Queried is implemented by outputers which need the query of the dump, e.g.
+// to read the time of its hits.
+type Queried interface {
+	SetQuery(query *core.QueryConfig)
+}
+
+// lookup returns the value of col in row, following the dots of nested
+// objects when row has no such key. Arrays of objects give the list of the
+// values found in each of them.
+func lookup(row core.M, col string) (any, bool) {
+	if v, ok := row[col]; ok {
+		return v, true
+	}
+	return lookupPath(map[string]any(row), col)
+}
+
+func lookupPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	switch v := v.(type) {
+	case core.M:
+		return lookupPath(map[string]any(v), path)
+	case map[string]any:
+		// keys may hold dots themselves, try the longest first
+		for n := len(path); n > 0; n = strings.LastIndexByte(path[:n], '.') {
+			if child, ok := v[path[:n]]; ok {
+				if found, ok := lookupPath(child, strings.TrimPrefix(path[n:], ".")); ok {
+					return found, true
+				}
+			}
+		}
+	case []any:
+		var values []any
+		for _, item := range v {
+			if found, ok := lookupPath(item, path); ok {
+				values = append(values, found)
+			}
+		}
+		return values, len(values) > 0
+	}
+	return nil, false
+}
+
 var _ Outputer[core.Hit] = (*csvOutputer[core.Hit])(nil)
 var _ Outputer[core.Hit] = (*xlsxOutputer[core.Hit])(nil)
+var _ Outputer[core.Hit] = (*ndjsonOutputer)(nil)
+var _ Outputer[core.Hit] = (*bulkOutputer)(nil)
+var _ Outputer[core.Hit] = (*reindexOutputer)(nil)
+
+var _ Resumable = (*csvOutputer[core.Hit])(nil)
+var _ Resumable = (*ndjsonOutputer)(nil)
+
+var _ Headered = (*csvOutputer[core.Hit])(nil)
+var _ Headered = (*xlsxOutputer[core.Hit])(nil)
+var _ Schemed = (*csvOutputer[core.Hit])(nil)
+var _ Schemed = (*xlsxOutputer[core.Hit])(nil)
@@ -0,0 +1,135 @@
+package outputer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// reindexOutputer indexes the hits straight into another cluster with _bulk,
+// keeping their _id and routing.
+type reindexOutputer struct {
+	ctx    context.Context
+	client *core.ESClient
+	index  string
+	query  *core.QueryConfig // to read the time of the hits, see SetQuery
+	loc    *time.Location
+}
+
+type ReindexOption func(*reindexOutputer)
+
+// WithIndexTimeZone sets the time zone the {time:...} placeholders of the
+// index template cut dates in, UTC if nil.
+func WithIndexTimeZone(loc *time.Location) ReindexOption {
+	return func(o *reindexOutputer) {
+		o.loc = loc
+	}
+}
+
+// NewReindex writes into the cluster of client. The index is a template in
+// which {index} is replaced by the index of the hit and {time:layout} by its
+// time formatted with the Go layout, e.g. staging-{time:2006.01.02}.
+func NewReindex(ctx context.Context, client *core.ESClient, index string, opts ...ReindexOption) *reindexOutputer {
+	o := &reindexOutputer{ctx: ctx, client: client, index: index, loc: time.UTC}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.loc == nil {
+		o.loc = time.UTC
+	}
+	return o
+}
+
+// SetQuery sets the query the hits come from, whose time field fills the
+// {time:...} placeholders. The scheduler sets it before the first batch.
+func (o *reindexOutputer) SetQuery(query *core.QueryConfig) {
+	o.query = query
+}
+
+func (o *reindexOutputer) Init() error {
+	return nil
+}
+
+func (o *reindexOutputer) Close() error {
+	return nil
+}
+
+// Load returns the number of hits indexed, and a core.BulkItemsError listing
+// the hits the target cluster rejected.
+func (o *reindexOutputer) Load(batch []core.Hit) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	items := make([]core.BulkItem, 0, len(batch))
+	for _, hit := range batch {
+		if hit.Source == nil {
+			return 0, fmt.Errorf("hit %v of %v has no _source to index", hit.ID, hit.Index)
+		}
+		index, err := o.indexName(hit)
+		if err != nil {
+			return 0, err
+		}
+		source, err := json.Marshal(hit.Source)
+		if err != nil {
+			return 0, core.MarshalErr(err)
+		}
+		items = append(items, core.BulkItem{Index: index, ID: hit.ID, Routing: hit.Routing, Source: source})
+	}
+	results, err := o.client.Bulk(o.ctx, items)
+	if err != nil {
+		return 0, err
+	}
+	var failures []core.BulkResult
+	for _, result := range results {
+		if result.Failed() {
+			failures = append(failures, result)
+		}
+	}
+	if failures != nil {
+		return len(batch) - len(failures), core.BulkItemsErr(failures)
+	}
+	return len(batch), nil
+}
+
+// indexName fills the index template for the hit.
+func (o *reindexOutputer) indexName(hit core.Hit) (string, error) {
+	if !strings.Contains(o.index, "{") {
+		return o.index, nil
+	}
+	var b strings.Builder
+	rest := o.index
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed placeholder in index template %v", o.index)
+		}
+		b.WriteString(rest[:start])
+		placeholder := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+
+		switch name, layout, _ := strings.Cut(placeholder, ":"); name {
+		case "index":
+			b.WriteString(hit.Index)
+		case "time":
+			if o.query == nil {
+				return "", fmt.Errorf("no query to read the time of hit %v of %v from", hit.ID, hit.Index)
+			}
+			t, err := o.query.HitTime(hit)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(t.In(o.loc).Format(layout))
+		default:
+			return "", fmt.Errorf("unknown placeholder {%v} in index template %v", placeholder, o.index)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package outputer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/internal/estest"
+)
+
+func Test_reindexOutputer_Load(t *testing.T) {
+	var indices []string
+	srv := estest.NewServer(t, estest.BulkHandler(t, func(item estest.BulkItem) estest.BulkResult {
+		indices = append(indices, item.Index+"/"+item.ID+"/"+item.Routing)
+		if item.ID == "3" {
+			return estest.BulkResult{Status: 409, Type: "version_conflict_engine_exception", Reason: "exists"}
+		}
+		return estest.BulkResult{}
+	}))
+	cli, err := core.NewClient([]string{srv.URL}, "", "", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := core.NewQueryConfig(
+		core.WithIndex("logs"),
+		core.WithTimeField("ts"),
+		core.WithTimeMapping(core.TimeMapping{Type: "date", Format: "yyyyMMdd"}),
+		core.WithStartTime(time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)),
+		core.WithEndTime(time.Date(2024, time.November, 9, 0, 0, 0, 0, time.UTC)),
+		core.WithBody(&core.ESBody{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewReindex(context.TODO(), cli, "staging-{index}-{time:2006.01.02}")
+	o.SetQuery(query)
+	// the dates of the source are read in the format of the mapping, not as
+	// epoch millis
+	batch := []core.Hit{
+		{ID: "1", Index: "logs", Routing: "u1", Source: core.M{"ts": "20241107"}, Sort: []json.RawMessage{json.RawMessage(`1730937600000`)}},
+		{ID: "2", Index: "logs", Source: core.M{"ts": "20241108"}},
+		{ID: "3", Index: "logs", Source: core.M{"ts": "20241107"}},
+	}
+	got, err := o.Load(batch)
+	if got != 2 {
+		t.Errorf("Load() = %v, want 2", got)
+	}
+	var itemsErr core.BulkItemsError
+	if !errors.As(err, &itemsErr) || len(itemsErr.Failures) != 1 || itemsErr.Failures[0].ID != "3" {
+		t.Errorf("Load() error = %v", err)
+	}
+	want := []string{"staging-logs-2024.11.07/1/u1", "staging-logs-2024.11.08/2/", "staging-logs-2024.11.07/3/"}
+	if !reflect.DeepEqual(indices, want) {
+		t.Errorf("indexed into %v, want %v", indices, want)
+	}
+}
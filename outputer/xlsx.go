@@ -4,12 +4,16 @@ import (
 	"sort"
 	"strconv"
 
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/spf13/cast"
 	"github.com/xuri/excelize/v2"
 )
 
 type xlsxOutputer[T Tablur] struct {
 	path       string
 	header     []string
+	columns    []string          // set by SetHeader
+	types      map[string]string // ES type per column, set by SetSchema
 	f          *excelize.File
 	sheetName  string
 	sheetIndex int
@@ -39,9 +43,25 @@ func (o *xlsxOutputer[T]) Close() (err error) {
 	return o.f.Close()
 }
 
+// SetHeader fixes the columns and their order.
+func (o *xlsxOutputer[T]) SetHeader(header []string) {
+	o.columns = header
+}
+
+// SetSchema takes the columns from the mapping, and writes numbers and
+// booleans as such rather than as text.
+func (o *xlsxOutputer[T]) SetSchema(schema core.Schema) {
+	o.columns = schema.Names()
+	o.types = schema.Types()
+}
+
 func (o *xlsxOutputer[T]) initHeader(header []string) error {
+	if o.columns != nil {
+		header = o.columns
+	} else {
+		sort.Strings(header)
+	}
 	o.header = header
-	sort.Strings(o.header)
 	return o.f.SetSheetRow(o.sheetName, "A1", &o.header)
 }
 
@@ -74,11 +94,15 @@ func (o *xlsxOutputer[T]) Load(batch []T) (int, error) {
 		row := record.GetValue()
 		value := make([]any, 0)
 		for _, col := range o.header {
-			val, ok := row[col]
+			val, ok := lookup(row, col)
 			if !ok {
 				value = append(value, "")
 				continue
 			}
+			if typed, ok := o.typedValue(col, val); ok {
+				value = append(value, typed)
+				continue
+			}
 			valStr, err := toString(val)
 			if err != nil {
 				return 0, err
@@ -92,3 +116,24 @@ func (o *xlsxOutputer[T]) Load(batch []T) (int, error) {
 	}
 	return len(batch), nil
 }
+
+// maxExactInt is the largest integer an Excel number, a float64, holds exactly.
+const maxExactInt = 1 << 53
+
+// typedValue converts val to the Go type matching the ES type of col, if it
+// is a number or a boolean. Integers an Excel number can't hold exactly, and
+// unsigned_long values which may not even fit an int64, stay text.
+func (o *xlsxOutputer[T]) typedValue(col string, val any) (any, bool) {
+	switch o.types[col] {
+	case "long", "integer", "short", "byte":
+		v, err := cast.ToInt64E(val)
+		return v, err == nil && v >= -maxExactInt && v <= maxExactInt
+	case "double", "float", "half_float", "scaled_float":
+		v, err := cast.ToFloat64E(val)
+		return v, err == nil
+	case "boolean":
+		v, err := cast.ToBoolE(val)
+		return v, err == nil
+	}
+	return nil, false
+}
@@ -1,6 +1,7 @@
 package outputer
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/TCP404/esdumpcore/core"
@@ -37,3 +38,14 @@ func Test_xlsxOutputer_Load(t *testing.T) {
 	})
 
 }
+
+func Test_xlsxOutputer_typedValue(t *testing.T) {
+	o := NewXLSX[core.Hit]("./test.xlsx")
+	o.SetSchema(core.Schema{{Name: "n", Type: "long"}, {Name: "u", Type: "unsigned_long"}})
+	if got, ok := o.typedValue("n", json.Number("42")); !ok || got != int64(42) {
+		t.Errorf("typedValue(long) = %v, %v, want 42", got, ok)
+	}
+	if got, ok := o.typedValue("u", json.Number("18446744073709551615")); ok {
+		t.Errorf("typedValue(unsigned_long) = %v, want it left as text", got)
+	}
+}
@@ -0,0 +1,222 @@
+package restore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// reader yields the documents of a dump file, io.EOF after the last one.
+type reader interface {
+	Next() (core.BulkItem, error)
+}
+
+// newReader picks the reader matching the format of the dump: CSV by its
+// extension, otherwise bulk when the first line is a bulk action and NDJSON
+// when it is not.
+func newReader(path string, r io.Reader) (reader, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return newCSVReader(r)
+	}
+	lines := &lineReader{r: bufio.NewReader(r)}
+	first, err := lines.next()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	lines.unread = first
+	if _, _, err := parseAction(first); !errors.Is(err, errNotAction) {
+		return &bulkReader{lines: lines}, nil
+	}
+	return &ndjsonReader{lines: lines}, nil
+}
+
+// lineReader reads the non blank lines of r, with no limit on their length.
+type lineReader struct {
+	r      *bufio.Reader
+	unread []byte
+	line   int
+}
+
+func (l *lineReader) next() ([]byte, error) {
+	if l.unread != nil {
+		line := l.unread
+		l.unread = nil
+		return line, nil
+	}
+	for {
+		line, err := l.r.ReadBytes('\n')
+		if len(line) > 0 || err == nil {
+			l.line++
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// bulkReader reads files written by the bulk outputer, or any _bulk body made
+// of index and create actions.
+type bulkReader struct {
+	lines *lineReader
+}
+
+func (b *bulkReader) Next() (core.BulkItem, error) {
+	line, err := b.lines.next()
+	if err != nil {
+		return core.BulkItem{}, err
+	}
+	action, meta, err := parseAction(line)
+	if err != nil {
+		return core.BulkItem{}, fmt.Errorf("line %v: %w", b.lines.line, err)
+	}
+	source, err := b.lines.next()
+	if errors.Is(err, io.EOF) {
+		return core.BulkItem{}, fmt.Errorf("line %v: %v action without source", b.lines.line, action)
+	}
+	if err != nil {
+		return core.BulkItem{}, err
+	}
+	return core.BulkItem{Action: action, Index: meta.Index, ID: meta.ID, Routing: meta.Routing, Source: source}, nil
+}
+
+var errNotAction = errors.New("not a bulk action")
+
+type actionMeta struct {
+	Index   string `json:"_index"`
+	ID      string `json:"_id"`
+	Routing string `json:"routing"`
+}
+
+// parseAction parses a bulk action line, refusing the actions which do not
+// carry a document.
+func parseAction(line []byte) (string, actionMeta, error) {
+	var action map[string]json.RawMessage
+	if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+		return "", actionMeta{}, errNotAction
+	}
+	for name, raw := range action {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return "", actionMeta{}, errNotAction
+		}
+		for k := range fields {
+			if !strings.HasPrefix(k, "_") && k != "routing" {
+				return "", actionMeta{}, errNotAction
+			}
+		}
+		switch name {
+		case "index", "create":
+		case "delete", "update":
+			return "", actionMeta{}, fmt.Errorf("unsupported bulk action %v", name)
+		default:
+			return "", actionMeta{}, errNotAction
+		}
+		var meta actionMeta
+		json.Unmarshal(raw, &meta)
+		return name, meta, nil
+	}
+	return "", actionMeta{}, errNotAction
+}
+
+// ndjsonReader reads files written by the NDJSON outputer. The _id and _index
+// it may have added are used as such, and _sort is dropped.
+type ndjsonReader struct {
+	lines *lineReader
+}
+
+func (n *ndjsonReader) Next() (core.BulkItem, error) {
+	line, err := n.lines.next()
+	if err != nil {
+		return core.BulkItem{}, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return core.BulkItem{}, fmt.Errorf("line %v: %w", n.lines.line, err)
+	}
+	var item core.BulkItem
+	json.Unmarshal(doc["_id"], &item.ID)
+	json.Unmarshal(doc["_index"], &item.Index)
+	if doc["_id"] == nil && doc["_index"] == nil && doc["_sort"] == nil {
+		item.Source = line
+		return item, nil
+	}
+	delete(doc, "_id")
+	delete(doc, "_index")
+	delete(doc, "_sort")
+	if item.Source, err = json.Marshal(doc); err != nil {
+		return core.BulkItem{}, err
+	}
+	return item, nil
+}
+
+// csvReader reads files written by the CSV outputer. Its values all come back
+// as strings, which ES coerces to the type of their field, and dotted columns
+// as nested objects. Empty cells are left out.
+//
+// The restore is lossy: the CSV outputer writes commas as full-width commas
+// and newlines as spaces, and objects or arrays as JSON text, which come back
+// as such. Restore NDJSON or bulk dumps to get the documents back exactly.
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	c := &csvReader{r: csv.NewReader(r)}
+	c.r.FieldsPerRecord = -1
+	header, err := c.r.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	c.header = header
+	return c, nil
+}
+
+func (c *csvReader) Next() (core.BulkItem, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return core.BulkItem{}, err
+	}
+	var item core.BulkItem
+	doc := make(map[string]any)
+	for n, value := range record {
+		if n >= len(c.header) || value == "" {
+			continue
+		}
+		switch col := c.header[n]; col {
+		case "_id":
+			item.ID = value
+		case "_index":
+			item.Index = value
+		default:
+			setPath(doc, strings.Split(col, "."), value)
+		}
+	}
+	if item.Source, err = json.Marshal(doc); err != nil {
+		return core.BulkItem{}, err
+	}
+	return item, nil
+}
+
+func setPath(doc map[string]any, path []string, value string) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := doc[key].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			doc[key] = child
+		}
+		doc = child
+	}
+	doc[path[len(path)-1]] = value
+}
@@ -0,0 +1,85 @@
+package restore
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func Test_newReader(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		dump string
+		want []core.BulkItem
+	}{
+		{
+			name: "bulk",
+			path: "dump.00000.ndjson",
+			dump: `{"index":{"_index":"logs","_id":"1","routing":"u1"}}` + "\n" + `{"name":"test1"}` + "\n" +
+				`{"create":{"_index":"logs"}}` + "\n\n" + `{"name":"test2"}` + "\n",
+			want: []core.BulkItem{
+				{Action: "index", Index: "logs", ID: "1", Routing: "u1", Source: []byte(`{"name":"test1"}`)},
+				{Action: "create", Index: "logs", Source: []byte(`{"name":"test2"}`)},
+			},
+		},
+		{
+			name: "ndjson",
+			path: "dump.ndjson",
+			dump: `{"_id":"1","_sort":[1],"index":{"a":1}}` + "\n" + `{"n":9007199254740993}`,
+			want: []core.BulkItem{
+				{ID: "1", Source: []byte(`{"index":{"a":1}}`)},
+				{Source: []byte(`{"n":9007199254740993}`)},
+			},
+		},
+		{
+			name: "csv",
+			path: "dump.csv",
+			dump: "_id,age,user.name,user.city\n1,31,test1,\n",
+			want: []core.BulkItem{
+				{ID: "1", Source: []byte(`{"age":"31","user":{"name":"test1"}}`)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newReader(tt.path, strings.NewReader(tt.dump))
+			if err != nil {
+				t.Fatalf("newReader() error = %v", err)
+			}
+			var got []core.BulkItem
+			for {
+				item, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				got = append(got, item)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v items, want %v", len(got), len(tt.want))
+			}
+			for n := range got {
+				if !reflect.DeepEqual(got[n], tt.want[n]) {
+					t.Errorf("item %v = %+v %s, want %+v %s", n, got[n], got[n].Source, tt.want[n], tt.want[n].Source)
+				}
+			}
+		})
+	}
+}
+
+func Test_bulkReader_Next(t *testing.T) {
+	r, err := newReader("dump.ndjson", strings.NewReader(`{"delete":{"_index":"logs","_id":"1"}}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err == nil {
+		t.Error("Next() of a delete action succeeded")
+	}
+}
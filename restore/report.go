@@ -0,0 +1,37 @@
+package restore
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Report sums up a Run.
+type Report struct {
+	Files   int
+	Docs    int64 // read from the files
+	Indexed int64
+	Failed  int64 // rejected by the cluster
+	Elapsed time.Duration
+}
+
+// LogValue logs the report as a group.
+func (r Report) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("files", r.Files),
+		slog.Int64("docs", r.Docs),
+		slog.Int64("indexed", r.Indexed),
+		slog.Int64("failed", r.Failed),
+		slog.Duration("elapsed", r.Elapsed),
+	)
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	b.WriteString("======= restore report =======\n")
+	fmt.Fprintf(&b, "files: %v, docs: %v, indexed: %v, failed: %v\n", r.Files, r.Docs, r.Indexed, r.Failed)
+	fmt.Fprintf(&b, "elapsed: %v\n", r.Elapsed.Round(time.Millisecond))
+	b.WriteString("======= restore report =======")
+	return b.String()
+}
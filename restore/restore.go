@@ -0,0 +1,240 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"golang.org/x/sync/errgroup"
+)
+
+// Loader indexes dump files back into a cluster with _bulk. It reads the
+// files of the bulk, NDJSON and CSV outputers.
+type Loader struct {
+	client *core.ESClient
+
+	index       string
+	workers     int
+	batchBytes  int
+	failurePath string
+
+	failures *os.File
+	mu       sync.Mutex
+	report   Report
+}
+
+type Option func(*Loader)
+
+// WithTargetIndex indexes every document into index, whatever the index
+// recorded in the dump.
+func WithTargetIndex(index string) Option {
+	return func(l *Loader) {
+		l.index = index
+	}
+}
+
+// WithWorkers sends n _bulk requests at a time.
+func WithWorkers(n int) Option {
+	return func(l *Loader) {
+		l.workers = n
+	}
+}
+
+// WithBatchBytes sets the size of each _bulk request, 5mb by default.
+func WithBatchBytes(n int) Option {
+	return func(l *Loader) {
+		l.batchBytes = n
+	}
+}
+
+// WithRetryPolicy sets how failed requests, and the documents rejected with a
+// 429 by a busy cluster, are retried. The client passed to New keeps its own
+// policy.
+func WithRetryPolicy(policy core.RetryPolicy) Option {
+	return func(l *Loader) {
+		l.client = l.client.WithRetryPolicy(policy)
+	}
+}
+
+// WithFailureFile writes the documents the cluster rejected to path, one JSON
+// object per line with the error and the source of the document.
+func WithFailureFile(path string) Option {
+	return func(l *Loader) {
+		l.failurePath = path
+	}
+}
+
+// New returns a loader indexing into the cluster of client, see
+// core.NewClientWithConfig.
+func New(client *core.ESClient, opts ...Option) (*Loader, error) {
+	l := &Loader{
+		client:     client,
+		workers:    1,
+		batchBytes: 5 << 20,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.workers < 1 {
+		return nil, errors.New("restore needs at least one worker")
+	}
+	return l, nil
+}
+
+// Run indexes the documents of the files, in order. Documents rejected by the
+// cluster do not stop it, they are counted in the report and written to the
+// failure file.
+func (l *Loader) Run(ctx context.Context, paths ...string) (err error) {
+	start := time.Now()
+	l.report = Report{Files: len(paths)}
+	if l.failurePath != "" {
+		if l.failures, err = os.Create(l.failurePath); err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, l.failures.Close())
+		}()
+	}
+
+	batches := make(chan []core.BulkItem, l.workers)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(batches)
+		for _, path := range paths {
+			if err := l.read(ctx, path, batches); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for range l.workers {
+		g.Go(func() error {
+			for batch := range batches {
+				if err := l.load(ctx, batch); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	l.report.Elapsed = time.Since(start)
+	slog.Info("restore report", slog.Any("report", l.report))
+	return err
+}
+
+// Report returns the report of the last Run.
+func (l *Loader) Report() Report {
+	return l.report
+}
+
+// read cuts the documents of the file into batches of about batchBytes.
+func (l *Loader) read(ctx context.Context, path string, batches chan<- []core.BulkItem) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := newReader(path, f)
+	if err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+
+	var batch []core.BulkItem
+	var size int
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case batches <- batch:
+		}
+		batch, size = nil, 0
+		return nil
+	}
+	for {
+		item, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return send()
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+		if l.index != "" {
+			item.Index = l.index
+		}
+		if item.Index == "" {
+			return fmt.Errorf("%v: document %v has no index, set a target index", path, item.ID)
+		}
+		atomic.AddInt64(&l.report.Docs, 1)
+		if size > 0 && size+item.Size() > l.batchBytes {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, item)
+		size += item.Size()
+	}
+}
+
+func (l *Loader) load(ctx context.Context, batch []core.BulkItem) error {
+	results, err := l.client.Bulk(ctx, batch)
+	if err != nil {
+		return err
+	}
+	for n, result := range results {
+		if !result.Failed() {
+			atomic.AddInt64(&l.report.Indexed, 1)
+			continue
+		}
+		atomic.AddInt64(&l.report.Failed, 1)
+		if err := l.fail(batch[n], result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failure is a line of the failure file.
+type failure struct {
+	Index  string             `json:"_index"`
+	ID     string             `json:"_id,omitempty"`
+	Status int                `json:"status"`
+	Error  *core.ESErrorCause `json:"error,omitempty"`
+	Source json.RawMessage    `json:"source"`
+}
+
+func (l *Loader) fail(item core.BulkItem, result core.BulkResult) error {
+	attrs := []any{slog.String("index", item.Index), slog.String("id", result.ID), slog.Int("status", result.Status)}
+	if result.Error != nil {
+		attrs = append(attrs, slog.String("type", result.Error.Type), slog.String("reason", result.Error.Reason))
+	}
+	slog.Warn("document rejected", attrs...)
+	if l.failures == nil {
+		return nil
+	}
+	b, err := json.Marshal(failure{
+		Index:  item.Index,
+		ID:     result.ID,
+		Status: result.Status,
+		Error:  result.Error,
+		Source: item.Source,
+	})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.failures.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,115 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/internal/estest"
+	"github.com/TCP404/esdumpcore/outputer"
+)
+
+func newTestClient(t *testing.T, url string) *core.ESClient {
+	t.Helper()
+	cli, err := core.NewClient([]string{url}, "", "", 20)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return cli
+}
+
+func Test_Loader_Run(t *testing.T) {
+	var mu sync.Mutex
+	var indices []string
+	srv := estest.NewServer(t, estest.BulkHandler(t, func(item estest.BulkItem) estest.BulkResult {
+		mu.Lock()
+		indices = append(indices, item.Index)
+		mu.Unlock()
+		if strings.Contains(item.Source, "bad") {
+			return estest.BulkResult{Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse field [age]"}
+		}
+		return estest.BulkResult{}
+	}))
+
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "dump.ndjson")
+	var lines []string
+	for n := range 10 {
+		age := fmt.Sprint(n)
+		if n == 4 {
+			age = `"bad"`
+		}
+		lines = append(lines, fmt.Sprintf(`{"_id":"%v","age":%v}`, n, age))
+	}
+	if err := os.WriteFile(dump, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	failures := filepath.Join(dir, "failures.ndjson")
+
+	l, err := New(newTestClient(t, srv.URL), WithTargetIndex("restored"), WithWorkers(3), WithBatchBytes(200), WithFailureFile(failures))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Run(context.TODO(), dump); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report := l.Report(); report.Docs != 10 || report.Indexed != 9 || report.Failed != 1 {
+		t.Errorf("Report() = %+v", report)
+	}
+	for _, index := range indices {
+		if index != "restored" {
+			t.Errorf("indexed into %v, want restored", index)
+		}
+	}
+	got, err := os.ReadFile(failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_index":"restored","_id":"4","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [age]"},"source":{"age":"bad"}}` + "\n"
+	if string(got) != want {
+		t.Errorf("failure file = %s, want %s", got, want)
+	}
+}
+
+func Test_Loader_Run_CSVRoundTrip(t *testing.T) {
+	var sources []string
+	srv := estest.NewServer(t, estest.BulkHandler(t, func(item estest.BulkItem) estest.BulkResult {
+		sources = append(sources, item.Source)
+		return estest.BulkResult{}
+	}))
+
+	dump := filepath.Join(t.TempDir(), "dump.csv")
+	out := outputer.NewCSV[core.Hit](dump)
+	out.SetHeader([]string{"msg", "n", "tags", "user.name"})
+	hit := core.Hit{Source: core.M{
+		"msg":  "hello, world\nbye",
+		"n":    42,
+		"tags": []any{"a", "b"},
+		"user": core.M{"name": "x"},
+	}}
+	if _, err := out.Load([]core.Hit{hit}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(newTestClient(t, srv.URL), WithTargetIndex("restored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Run(context.TODO(), dump); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// values come back as strings, with the separators the outputer replaced
+	want := []string{`{"msg":"hello， world bye","n":"42","tags":"[\"a\"，\"b\"]","user":{"name":"x"}}`}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("restored sources = %v, want %v", sources, want)
+	}
+}
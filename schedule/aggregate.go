@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/outputer"
+)
+
+// RunComposite dumps the buckets of a composite aggregation over the query
+// into out, one row per bucket.
+func (s *Scheduler) RunComposite(ctx context.Context, queryConfig *core.QueryConfig, agg core.CompositeAgg, out outputer.Outputer[core.Bucket]) (err error) {
+	if _, err := s.Preflight(ctx, queryConfig); err != nil {
+		return err
+	}
+	if err := out.Init(); err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, out.Close())
+	}()
+
+	var loadErr error
+	err = s.client.CompositeWithConsume(ctx, queryConfig, agg, func(c chan core.Bucket) {
+		loadErr = loadBatches(c, out, agg.Header())
+	})
+	if err = errors.Join(err, loadErr); err != nil {
+		return err
+	}
+	s.logReport(queryConfig)
+	return nil
+}
+
+// loadBatches loads the rows of c into out in batches, with header or else
+// the header of the first row. After a load error the rest of c is drained so
+// the producer is not blocked.
+func loadBatches[T outputer.Tablur](c chan T, out outputer.Outputer[T], header []string) error {
+	const batchSize = 100
+	var (
+		batch = make([]T, 0, batchSize)
+		first = true
+		err   error
+	)
+	flush := func() {
+		if err != nil || len(batch) == 0 {
+			return
+		}
+		if headered, ok := out.(outputer.Headered); ok && first {
+			if header == nil {
+				header = batch[0].GetHeader()
+			}
+			headered.SetHeader(header)
+		}
+		first = false
+		_, err = out.Load(batch)
+		batch = batch[:0]
+	}
+	for row := range c {
+		if err != nil {
+			continue
+		}
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+	return err
+}
+
+// RunHistogram writes the count per time bucket of the query into out, one
+// row per bucket and one column per split value.
+func (s *Scheduler) RunHistogram(ctx context.Context, queryConfig *core.QueryConfig, h core.Histogram, out outputer.Outputer[core.PivotRow]) (err error) {
+	if _, err := s.Preflight(ctx, queryConfig); err != nil {
+		return err
+	}
+	rows, err := s.client.DateHistogram(ctx, queryConfig, h)
+	if err != nil {
+		return err
+	}
+	if err := out.Init(); err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, out.Close())
+	}()
+
+	if headered, ok := out.(outputer.Headered); ok && len(rows) > 0 {
+		headered.SetHeader(rows[0].GetHeader())
+	}
+	for batch := range slices.Chunk(rows, 100) {
+		if _, err := out.Load(batch); err != nil {
+			return err
+		}
+	}
+	s.logReport(queryConfig)
+	return nil
+}
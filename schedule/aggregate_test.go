@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// headerOutputer records the header it is given.
+type headerOutputer struct {
+	header []string
+	rows   int
+}
+
+func (o *headerOutputer) Init() error               { return nil }
+func (o *headerOutputer) Close() error              { return nil }
+func (o *headerOutputer) SetHeader(header []string) { o.header = header }
+func (o *headerOutputer) Load(batch []core.Bucket) (int, error) {
+	o.rows += len(batch)
+	return len(batch), nil
+}
+
+func Test_loadBatches_Header(t *testing.T) {
+	c := make(chan core.Bucket, 2)
+	c <- core.Bucket{Key: core.M{"host": "a"}}
+	c <- core.Bucket{Key: core.M{"host": "b"}}
+	close(c)
+
+	out := &headerOutputer{}
+	want := []string{"host", "doc_count", "p.50.0"}
+	if err := loadBatches(c, out, want); err != nil {
+		t.Fatalf("loadBatches() error = %v", err)
+	}
+	if fmt.Sprint(out.header) != fmt.Sprint(want) || out.rows != 2 {
+		t.Errorf("loadBatches() header %v with %v rows, want %v with 2 rows", out.header, out.rows, want)
+	}
+}
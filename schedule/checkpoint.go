@@ -0,0 +1,99 @@
+package schedule
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/outputer"
+	"github.com/TCP404/eutil/etl"
+)
+
+// orderedBatchSize is the number of hits written at once by a checkpointed run.
+const orderedBatchSize = 100
+
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	state    *core.Checkpoint
+	savedAt  time.Time
+}
+
+// record moves the checkpoint past last, the last hit extracted for a batch
+// of rows fully written to out, and saves it at most once per interval. The
+// offset is taken here, so that a batch failing partway is not counted.
+func (c *checkpointer) record(out outputer.Outputer[L], query *core.QueryConfig, last E, rows int) error {
+	c.state.Advance(query, last, rows)
+	if resumable, ok := out.(outputer.Resumable); ok {
+		offset, err := resumable.Offset()
+		if err != nil {
+			return err
+		}
+		c.state.Offset = offset
+	}
+	if time.Since(c.savedAt) < c.interval {
+		return nil
+	}
+	if err := c.save(); err != nil {
+		slog.Warn("save checkpoint error", slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+func (c *checkpointer) save() error {
+	c.savedAt = time.Now()
+	return c.state.Save(c.path)
+}
+
+func (c *checkpointer) remove() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// runOrdered extracts, transforms and loads one batch at a time, so that the
+// checkpoint only moves past hits which all reached the output. It stops at
+// the first error.
+func (s *Scheduler) runOrdered(ctx context.Context, queryConfig *core.QueryConfig, transformFunc etl.TransformFunc[E, L]) error {
+	s.iter = core.NewQueryIterator(ctx, s.client, queryConfig)
+	load := s.outputer.Load
+	if s.incremental != nil {
+		load = s.incremental.wrap(queryConfig, load)
+	}
+	batch := make([]E, 0, orderedBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		target, err := transformFunc(batch)
+		if err != nil {
+			return err
+		}
+		n, err := load(target)
+		if err != nil {
+			return err
+		}
+		if err := s.checkpoint.record(s.outputer, queryConfig, batch[len(batch)-1], n); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for ctx.Err() == nil && s.iter.Next() {
+		batch = append(batch, s.iter.Value())
+		if len(batch) < orderedBatchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil || s.iter.Err() != nil {
+		// finish reports them, the partial batch is dropped
+		return nil
+	}
+	return flush()
+}
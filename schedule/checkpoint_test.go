@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func Test_Scheduler_LoadError(t *testing.T) {
+	out := &memOutputer{failOn: 2}
+	s := newTestScheduler(t, fakeCluster(t, testHits(250)), out)
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 250); !errors.Is(err, errDiskFull) {
+		t.Errorf("RunETL() error = %v, want %v", err, errDiskFull)
+	}
+}
+
+func Test_Scheduler_CheckpointLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	out := &memOutputer{failOn: 2}
+	s := newTestScheduler(t, fakeCluster(t, testHits(250)), out, WithCheckpoint(path, time.Hour))
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 250); !errors.Is(err, errDiskFull) {
+		t.Fatalf("RunETL() error = %v, want %v", err, errDiskFull)
+	}
+	if out.loads != 2 || len(out.rows) != 150 {
+		t.Errorf("RunETL() loaded %v batches and %v rows, want to stop halfway through the second batch", out.loads, len(out.rows))
+	}
+
+	cp, err := core.LoadCheckpoint(path)
+	if err != nil || cp == nil {
+		t.Fatalf("LoadCheckpoint() = %v, %v, want the saved checkpoint", cp, err)
+	}
+	if want := testStart.Add(99 * time.Second); cp.Rows != 100 || !cp.Start.Equal(want) {
+		t.Errorf("checkpoint at %v after %v rows, want %v after 100 rows", cp.Start, cp.Rows, want)
+	}
+	// the rows of the failed batch are dropped on resume
+	if cp.Offset != 100 {
+		t.Errorf("checkpoint offset = %v, want 100", cp.Offset)
+	}
+}
+
+func Test_Scheduler_ReportOnError(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	s := newTestScheduler(t, fakeCluster(t, testHits(10)), &memOutputer{failOn: 1})
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 10); err == nil {
+		t.Fatal("RunETL() error = nil, want the load error")
+	}
+	if !strings.Contains(buf.String(), `"msg":"run report"`) {
+		t.Errorf("log = %s, want the run report", buf.String())
+	}
+}
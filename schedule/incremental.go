@@ -0,0 +1,153 @@
+package schedule
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/eutil/etl"
+)
+
+// watermark is what one incremental job remembers between runs.
+type watermark struct {
+	Time time.Time `json:"time"`          // max time field value written
+	IDs  []string  `json:"ids,omitempty"` // ids written within lookback of Time
+}
+
+type incremental struct {
+	path     string
+	job      string
+	lookback time.Duration
+
+	mux      sync.Mutex
+	skip     map[string]struct{}  // ids written by the previous run
+	maxTime  time.Time            // of this run
+	recent   map[string]time.Time // id -> time, candidates for the next skip
+	pruneLen int
+	failed   bool // a batch did not reach the output
+}
+
+func loadWatermarks(path string) (map[string]watermark, error) {
+	marks := make(map[string]watermark)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return marks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &marks); err != nil {
+		return nil, core.UnmarshalErr(err)
+	}
+	return marks, nil
+}
+
+// start loads the watermark of the job and returns where this run starts,
+// or ok false when the job has never run.
+func (i *incremental) start() (start time.Time, ok bool, err error) {
+	marks, err := loadWatermarks(i.path)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	i.skip = make(map[string]struct{})
+	i.recent = make(map[string]time.Time)
+	mark, ok := marks[i.job]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	for _, id := range mark.IDs {
+		i.skip[id] = struct{}{}
+	}
+	i.maxTime = mark.Time
+	return mark.Time.Add(-i.lookback), true, nil
+}
+
+// wrap drops hits already written by the previous run and tracks the
+// watermark of the hits of query written by this one.
+func (i *incremental) wrap(query *core.QueryConfig, load etl.LoadFunc[L]) etl.LoadFunc[L] {
+	return func(batch []L) (int, error) {
+		fresh := make([]L, 0, len(batch))
+		for _, hit := range batch {
+			if _, ok := i.skip[hit.ID]; !ok {
+				fresh = append(fresh, hit)
+			}
+		}
+		n, err := load(fresh)
+		if err != nil {
+			i.mux.Lock()
+			i.failed = true
+			i.mux.Unlock()
+			return n, err
+		}
+		// skipped hits are in the output too, so they count as well
+		i.track(query, batch)
+		return n, nil
+	}
+}
+
+func (i *incremental) track(query *core.QueryConfig, batch []L) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	for _, hit := range batch {
+		t, err := query.HitTime(hit)
+		if err != nil {
+			continue
+		}
+		if t.After(i.maxTime) {
+			i.maxTime = t
+		}
+		if !t.Before(i.maxTime.Add(-i.lookback)) {
+			i.recent[hit.ID] = t
+		}
+	}
+	if len(i.recent) > max(i.pruneLen*2, 10000) {
+		i.prune()
+		i.pruneLen = len(i.recent)
+	}
+}
+
+func (i *incremental) prune() {
+	for id, t := range i.recent {
+		if t.Before(i.maxTime.Add(-i.lookback)) {
+			delete(i.recent, id)
+		}
+	}
+}
+
+// save persists the watermark of the job for the next run. Nothing is saved
+// after a failed batch, so the next run writes it again.
+func (i *incremental) save() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.failed || i.maxTime.IsZero() {
+		return nil
+	}
+	i.prune()
+	mark := watermark{Time: i.maxTime, IDs: make([]string, 0, len(i.recent))}
+	for id := range i.recent {
+		mark.IDs = append(mark.IDs, id)
+	}
+	// nothing seen this run, the previous overlap is still the overlap
+	if len(i.recent) == 0 {
+		for id := range i.skip {
+			mark.IDs = append(mark.IDs, id)
+		}
+	}
+
+	marks, err := loadWatermarks(i.path)
+	if err != nil {
+		return err
+	}
+	marks[i.job] = mark
+	b, err := json.Marshal(marks)
+	if err != nil {
+		return core.MarshalErr(err)
+	}
+	tmp := i.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, i.path)
+}
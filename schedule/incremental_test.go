@@ -0,0 +1,99 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+func hitAt(id string, t time.Time) core.Hit {
+	return core.Hit{ID: id, Sort: []json.RawMessage{json.RawMessage(fmt.Sprint(t.UnixMilli()))}}
+}
+
+func Test_incremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	base := time.Date(2024, time.November, 7, 10, 0, 0, 0, time.UTC)
+	query := newTestQuery(t)
+
+	var written []string
+	load := func(batch []L) (int, error) {
+		for _, hit := range batch {
+			written = append(written, hit.ID)
+		}
+		return len(batch), nil
+	}
+
+	first := &incremental{path: path, job: "job", lookback: 10 * time.Minute}
+	if _, ok, err := first.start(); err != nil || ok {
+		t.Fatalf("start() = %v, %v, want no watermark", ok, err)
+	}
+	first.wrap(query, load)([]L{
+		hitAt("a", base),
+		hitAt("b", base.Add(55*time.Minute)),
+		hitAt("c", base.Add(time.Hour)),
+	})
+	if err := first.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	second := &incremental{path: path, job: "job", lookback: 10 * time.Minute}
+	start, ok, err := second.start()
+	if err != nil || !ok {
+		t.Fatalf("start() = %v, %v, want a watermark", ok, err)
+	}
+	if want := base.Add(50 * time.Minute); !start.Equal(want) {
+		t.Errorf("start() = %v, want %v", start, want)
+	}
+	written = nil
+	second.wrap(query, load)([]L{
+		hitAt("b", base.Add(55*time.Minute)),
+		hitAt("late", base.Add(58*time.Minute)),
+		hitAt("c", base.Add(time.Hour)),
+		hitAt("d", base.Add(70*time.Minute)),
+	})
+	if fmt.Sprint(written) != "[late d]" {
+		t.Errorf("second run wrote %v, want [late d]", written)
+	}
+}
+
+func Test_incremental_EpochSecond(t *testing.T) {
+	query := newTestQuery(t, core.WithTimeMapping(core.TimeMapping{Type: "long", Format: "epoch_second"}))
+	last := testStart.Add(time.Hour)
+	i := &incremental{path: filepath.Join(t.TempDir(), "state.json"), job: "job", lookback: time.Minute}
+	if _, _, err := i.start(); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	i.track(query, []L{{ID: "a", Sort: []json.RawMessage{json.RawMessage(fmt.Sprint(last.Unix()))}}})
+	if !i.maxTime.Equal(last) {
+		t.Errorf("track() watermark = %v, want %v", i.maxTime, last)
+	}
+}
+
+func Test_Scheduler_IncrementalLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	out := &memOutputer{failOn: 1}
+	s := newTestScheduler(t, fakeCluster(t, testHits(250)), out, WithIncremental(path, "job", time.Minute))
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 250); !errors.Is(err, errDiskFull) {
+		t.Errorf("RunETL() error = %v, want %v", err, errDiskFull)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("watermark saved after a failed batch, stat error = %v", err)
+	}
+	if err := s.incremental.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("save() wrote the watermark of a failed run, stat error = %v", err)
+	}
+}
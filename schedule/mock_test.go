@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/internal/estest"
+	"github.com/TCP404/esdumpcore/outputer"
+)
+
+var (
+	testStart = time.Date(2024, time.November, 7, 0, 0, 0, 0, time.UTC)
+	testEnd   = time.Date(2024, time.November, 8, 0, 0, 0, 0, time.UTC)
+)
+
+// newTestScheduler starts a fake cluster served by handler and returns a
+// scheduler dumping the ts field of idx from testStart to testEnd into out.
+func newTestScheduler(t *testing.T, handler http.HandlerFunc, out outputer.Outputer[L], opts ...Option) *Scheduler {
+	t.Helper()
+	srv := estest.NewServer(t, handler)
+	s, err := New(srv.URL, "", "", "idx", "ts", testStart, testEnd, "", out, nil, opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+// newTestQuery builds a query on the ts field of idx from testStart to
+// testEnd, with opt applied over these defaults.
+func newTestQuery(t *testing.T, opt ...core.OptFn) *core.QueryConfig {
+	t.Helper()
+	q, err := core.NewQueryConfig(append([]core.OptFn{
+		core.WithIndex("idx"),
+		core.WithTimeField("ts"),
+		core.WithStartTime(testStart),
+		core.WithEndTime(testEnd),
+		core.WithBody(&core.ESBody{}),
+	}, opt...)...)
+	if err != nil {
+		t.Fatalf("NewQueryConfig() error = %v", err)
+	}
+	return q
+}
+
+// fakeCluster answers the preflight and searches of a dump of idx holding hits.
+func fakeCluster(t *testing.T, hits core.BatchHit) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cat/indices/idx":
+			fmt.Fprintf(w, `[{"index":"idx","status":"open","docs.count":"%v"}]`, len(hits))
+		case "/idx/_mapping/field/ts":
+			w.Write([]byte(`{"idx":{"mappings":{"ts":{"full_name":"ts","mapping":{"ts":{"type":"date"}}}}}}`))
+		case "/idx/_validate/query":
+			w.Write([]byte(`{"valid":true}`))
+		case "/idx/_search":
+			var resp core.ESResponse
+			resp.Hits.Hits = hits
+			resp.Hits.Total.Value = len(hits)
+			json.NewEncoder(w).Encode(resp)
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// testHits returns n hits one second apart from testStart.
+func testHits(n int) core.BatchHit {
+	hits := make(core.BatchHit, n)
+	for i := range hits {
+		hits[i] = hitAt(fmt.Sprint(i), testStart.Add(time.Duration(i)*time.Second))
+	}
+	return hits
+}
+
+var errDiskFull = errors.New("disk full")
+
+// memOutputer keeps the hits it is given, failing the load number failOn
+// after writing half of its batch.
+type memOutputer struct {
+	failOn int
+	loads  int
+	rows   []core.Hit
+}
+
+func (o *memOutputer) Init() error  { return nil }
+func (o *memOutputer) Close() error { return nil }
+
+func (o *memOutputer) Load(batch []L) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	o.loads++
+	if o.loads == o.failOn {
+		o.rows = append(o.rows, batch[:len(batch)/2]...)
+		return 0, errDiskFull
+	}
+	o.rows = append(o.rows, batch...)
+	return len(batch), nil
+}
+
+func (o *memOutputer) Offset() (int64, error) {
+	return int64(len(o.rows)), nil
+}
+
+func (o *memOutputer) Resume(offset int64) error {
+	o.rows = o.rows[:offset]
+	return nil
+}
+
+func identity(batch []E) ([]L, error) {
+	return batch, nil
+}
@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/TCP404/esdumpcore/core"
+)
+
+// Report summarizes the last run of a Scheduler.
+type Report struct {
+	StartTime time.Time // resolved absolute range
+	EndTime   time.Time
+	StartExpr string // date math the range was given as, if any
+	EndExpr   string
+	Partial   core.PartialResults
+}
+
+// LogValue logs the report as a group, one shard failure per attribute.
+func (r Report) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Time("start", r.StartTime),
+		slog.Time("end", r.EndTime),
+	}
+	if r.StartExpr != "" || r.EndExpr != "" {
+		attrs = append(attrs, slog.String("date_math", r.StartExpr+" ~ "+r.EndExpr))
+	}
+	attrs = append(attrs,
+		slog.Int("partial_responses", r.Partial.Responses),
+		slog.Int("timed_out", r.Partial.TimedOut),
+		slog.Int("skipped_shards", r.Partial.Skipped),
+		slog.Int("failed_shards", r.Partial.Failed),
+	)
+	for n, f := range r.Partial.Failures {
+		attrs = append(attrs, slog.String(fmt.Sprint("failure_", n),
+			fmt.Sprintf("shard %v of %v on node %v: %v: %v", f.Shard, f.Index, f.Node, f.Reason.Type, f.Reason.Reason)))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	b.WriteString("======= run report =======\n")
+	fmt.Fprintf(&b, "time range: %v ~ %v\n", r.StartTime.Format(time.RFC3339), r.EndTime.Format(time.RFC3339))
+	if r.StartExpr != "" || r.EndExpr != "" {
+		fmt.Fprintf(&b, "date math: %v ~ %v\n", r.StartExpr, r.EndExpr)
+	}
+	fmt.Fprintf(&b, "%v\n", r.Partial)
+	for _, f := range r.Partial.Failures {
+		fmt.Fprintf(&b, "  shard %v of %v on node %v: %v: %v\n", f.Shard, f.Index, f.Node, f.Reason.Type, f.Reason.Reason)
+	}
+	b.WriteString("======= run report =======")
+	return b.String()
+}
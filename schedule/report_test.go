@@ -0,0 +1,42 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func Test_Scheduler_Report(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	s := newTestScheduler(t, fakeCluster(t, testHits(10)), &memOutputer{})
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 10); err != nil {
+		t.Fatalf("RunETL() error = %v", err)
+	}
+	if report := s.Report(); !report.StartTime.Equal(testStart) || !report.EndTime.Equal(testEnd) {
+		t.Errorf("Report() range = %v ~ %v, want %v ~ %v", report.StartTime, report.EndTime, testStart, testEnd)
+	}
+
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+		var record struct {
+			Msg    string         `json:"msg"`
+			Report map[string]any `json:"report"`
+		}
+		if json.Unmarshal(line, &record) != nil || record.Msg != "run report" {
+			continue
+		}
+		if _, ok := record.Report["failed_shards"]; !ok {
+			t.Errorf("run report logged as %s, want the report attributes", line)
+		}
+		return
+	}
+	t.Errorf("no run report in the log %s", buf.Bytes())
+}
@@ -2,7 +2,11 @@ package schedule
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/TCP404/esdumpcore/core"
@@ -26,6 +30,163 @@ type Scheduler struct {
 	condition *core.ESBodyBool
 	chanSize  int
 	client    *core.ESClient
+
+	workers           int
+	ordered           bool
+	windowStep        time.Duration
+	histogramInterval time.Duration
+	timeZone          *time.Location
+	startExpr         string
+	endExpr           string
+	now               time.Time
+	passthrough       bool
+	kql               string
+	queryString       string
+	clauses           []core.M // parsed from kql and queryString
+	rawBody           *core.ESBody
+	schema            bool
+
+	checkpoint  *checkpointer
+	resume      bool
+	incremental *incremental
+	iter        etl.Iterator[E]
+	failures    *failures
+	report      Report
+}
+
+type Option func(*Scheduler)
+
+// WithDateMath sets the range as ES date math, e.g. now-1d/d to now/d, taking
+// the place of the start and end times passed to New. An empty expression
+// keeps the time passed to New.
+func WithDateMath(startExpr, endExpr string) Option {
+	return func(s *Scheduler) {
+		s.startExpr = startExpr
+		s.endExpr = endExpr
+	}
+}
+
+// WithNow pins the clock date math is resolved against.
+func WithNow(now time.Time) Option {
+	return func(s *Scheduler) {
+		s.now = now
+	}
+}
+
+// WithDateMathPassthrough lets ES resolve the date math of the range filter.
+func WithDateMathPassthrough() Option {
+	return func(s *Scheduler) {
+		s.passthrough = true
+	}
+}
+
+// WithKQL filters the dump with a Kibana Query Language expression, on top of
+// the condition passed to New.
+func WithKQL(expr string) Option {
+	return func(s *Scheduler) {
+		s.kql = expr
+	}
+}
+
+// WithQueryString filters the dump with a Lucene query_string query, on top of
+// the condition passed to New.
+func WithQueryString(q string) Option {
+	return func(s *Scheduler) {
+		s.queryString = q
+	}
+}
+
+// WithRawBody starts the query from a search body written in the query DSL,
+// see core.ParseESBody, on top of which the condition passed to New applies.
+func WithRawBody(body *core.ESBody) Option {
+	return func(s *Scheduler) {
+		s.rawBody = body
+	}
+}
+
+// WithSchema takes the columns of the output, and their types, from the
+// mapping of the index rather than from the first batch.
+func WithSchema() Option {
+	return func(s *Scheduler) {
+		s.schema = true
+	}
+}
+
+// WithTimeZone sets the time zone of time field values written without one.
+func WithTimeZone(loc *time.Location) Option {
+	return func(s *Scheduler) {
+		s.timeZone = loc
+	}
+}
+
+// WithWorkers extracts the time range with n concurrent iterators, each of
+// them walking its own sub-window.
+func WithWorkers(n int) Option {
+	return func(s *Scheduler) {
+		s.workers = n
+	}
+}
+
+// WithOrdered keeps the output in time order when extracting with several
+// workers. Unordered output is loaded as soon as any worker produces it.
+func WithOrdered(ordered bool) Option {
+	return func(s *Scheduler) {
+		s.ordered = ordered
+	}
+}
+
+// WithWindowStep splits the time range into sub-windows of a fixed length.
+// By default the range is split evenly between the workers.
+func WithWindowStep(step time.Duration) Option {
+	return func(s *Scheduler) {
+		s.windowStep = step
+	}
+}
+
+// WithHistogramWindows splits the time range into sub-windows holding roughly
+// the same number of documents, measured by a date_histogram with the given
+// interval.
+func WithHistogramWindows(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		s.histogramInterval = interval
+	}
+}
+
+// WithCheckpoint saves the progress of the dump to path at most once per
+// interval. The file is removed once the dump completes. A checkpointed dump
+// transforms and writes one batch at a time, in order.
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(s *Scheduler) {
+		s.checkpoint = &checkpointer{path: path, interval: interval}
+	}
+}
+
+// WithResume continues an interrupted dump from its checkpoint file, if there
+// is one, appending to the existing output.
+func WithResume() Option {
+	return func(s *Scheduler) {
+		s.resume = true
+	}
+}
+
+// WithIncremental makes the scheduler start where the previous run of job
+// stopped, as recorded in the state file at path. The start time passed to New
+// is only used for the first run. The next run starts lookback before the
+// newest time written, to catch late documents, and skips the ids it already
+// wrote within that overlap.
+func WithIncremental(path, job string, lookback time.Duration) Option {
+	return func(s *Scheduler) {
+		s.incremental = &incremental{path: path, job: job, lookback: lookback}
+	}
+}
+
+// WithExactNumbers decodes the numbers of the hits as json.Number instead of
+// float64, so that longs beyond 2^53 are written unchanged. The transform
+// function then sees json.Number values.
+func WithExactNumbers() Option {
+	return func(s *Scheduler) {
+		s.client.SetExactNumbers(true)
+	}
 }
 
 func New(
@@ -33,13 +194,14 @@ func New(
 	startTime, endTime time.Time,
 	output string, outputerHandler outputer.Outputer[L],
 	condition *core.ESBodyBool,
+	opts ...Option,
 ) (*Scheduler, error) {
 	chanSize := 1000
 	client, err := core.NewClient([]string{host}, username, password, chanSize)
 	if err != nil {
 		return nil, err
 	}
-	return &Scheduler{
+	s := &Scheduler{
 		host:      host,
 		username:  username,
 		password:  password,
@@ -52,7 +214,58 @@ func New(
 		condition: condition,
 		chanSize:  chanSize,
 		client:    client,
-	}, nil
+		workers:   1,
+		ordered:   true,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.resolveDateMath(); err != nil {
+		return nil, err
+	}
+	if s.kql != "" {
+		clause, err := core.ParseKQL(s.kql)
+		if err != nil {
+			return nil, err
+		}
+		s.clauses = append(s.clauses, clause)
+	}
+	if s.queryString != "" {
+		s.clauses = append(s.clauses, core.QueryString(s.queryString))
+	}
+	if s.incremental != nil {
+		start, ok, err := s.incremental.start()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.startTime, s.startExpr = start, ""
+		}
+	}
+	if s.checkpoint != nil {
+		s.checkpoint.state = &core.Checkpoint{Start: s.startTime, End: s.endTime}
+	}
+	return s, nil
+}
+
+// resolveDateMath pins the clock and resolves the date math of the range, so
+// the query and the report agree on the same absolute window.
+func (s *Scheduler) resolveDateMath() error {
+	if s.now.IsZero() {
+		s.now = time.Now()
+	}
+	var err error
+	if s.startExpr != "" {
+		if s.startTime, err = core.ResolveDateMath(s.startExpr, s.now, s.timeZone); err != nil {
+			return err
+		}
+	}
+	if s.endExpr != "" {
+		if s.endTime, err = core.ResolveDateMath(s.endExpr, s.now, s.timeZone); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Scheduler) String() string {
@@ -63,19 +276,48 @@ func (s *Scheduler) String() string {
 }
 
 func (s *Scheduler) BuildQuery() (*core.QueryConfig, error) {
-	queryConfig, err := core.NewQueryConfig(
+	opts := []core.OptFn{
 		core.WithIndex(s.index),
 		core.WithTimeField(s.timeField),
 		core.WithStartTime(s.startTime),
 		core.WithEndTime(s.endTime),
+		core.WithTimeZone(s.timeZone),
+		core.WithStartExpr(s.startExpr),
+		core.WithEndExpr(s.endExpr),
+		core.WithNow(s.now),
 		core.WithBody(s.handleCondition()),
-	)
+	}
+	if s.passthrough {
+		opts = append(opts, core.WithDateMathPassthrough())
+	}
+	queryConfig, err := core.NewQueryConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
 	return queryConfig, nil
 }
 
+// BuildSQLQuery builds the query from an ES SQL statement, over the time field
+// and range of the scheduler.
+func (s *Scheduler) BuildSQLQuery(ctx context.Context, sql string) (*core.QueryConfig, error) {
+	opts := []core.OptFn{
+		core.WithTimeField(s.timeField),
+		core.WithStartTime(s.startTime),
+		core.WithEndTime(s.endTime),
+		core.WithTimeZone(s.timeZone),
+		core.WithStartExpr(s.startExpr),
+		core.WithEndExpr(s.endExpr),
+		core.WithNow(s.now),
+	}
+	if s.index != "" {
+		opts = append(opts, core.WithIndex(s.index))
+	}
+	if s.passthrough {
+		opts = append(opts, core.WithDateMathPassthrough())
+	}
+	return core.NewSQLQueryConfig(ctx, s.client, sql, opts...)
+}
+
 // func (s *Scheduler) Run(queryConfig *core.QueryConfig, outputHandler outputer.Outputer[L]) error {
 
 // 	ctx, cancel := signal.NotifyContext(context.TODO(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
@@ -142,37 +384,213 @@ func (s *Scheduler) BuildQuery() (*core.QueryConfig, error) {
 // }
 
 func (s *Scheduler) RunETL(ctx context.Context, queryConfig *core.QueryConfig, transformFunc etl.TransformFunc[E, L], total uint64) (err error) {
-	if err := s.outputer.Init(); err != nil {
+	if _, err := s.Preflight(ctx, queryConfig); err != nil {
 		return err
 	}
+	if err := s.initOutput(queryConfig); err != nil {
+		return err
+	}
+	// the checkpoint and the report matter most when the run fails
 	defer func() {
+		err = s.finish(ctx, err)
+		s.logReport(queryConfig)
 		s.outputer.Close()
 	}()
+	if schemed, ok := s.outputer.(outputer.Schemed); ok && s.schema {
+		schema, err := s.client.Schema(ctx, queryConfig)
+		if err != nil {
+			return err
+		}
+		schemed.SetSchema(schema)
+	}
+	if columns := queryConfig.Columns(); columns != nil {
+		if headered, ok := s.outputer.(outputer.Headered); ok {
+			headered.SetHeader(columns)
+		}
+	}
+	if queried, ok := s.outputer.(outputer.Queried); ok {
+		queried.SetQuery(queryConfig)
+	}
+	if s.checkpoint != nil {
+		return s.runOrdered(ctx, queryConfig, transformFunc)
+	}
 	engine, err := s.BuildWithETL(queryConfig, transformFunc, total)
+	if err != nil || engine == nil {
+		return err
+	}
+	if err := engine.Run(ctx); err != nil {
+		return err
+	}
+	return s.failures.err()
+}
+
+// logReport records the report of the run, see Report, and logs it.
+func (s *Scheduler) logReport(queryConfig *core.QueryConfig) {
+	s.report = Report{Partial: queryConfig.PartialResults()}
+	s.report.StartTime, s.report.EndTime = queryConfig.TimeRange()
+	s.report.StartExpr, s.report.EndExpr = queryConfig.DateMath()
+	slog.Info("run report", slog.Any("report", s.report))
+}
+
+// Report returns the report of the last RunETL.
+func (s *Scheduler) Report() Report {
+	return s.report
+}
+
+// Preflight resolves the indices targeted by the query and logs their
+// document counts. It also reads the mapping of the time field when the query
+// does not set it, so its range filters follow the format of the field, and
+// validates the query. Credentials allowed to search but not to list the
+// indices only get a warning.
+func (s *Scheduler) Preflight(ctx context.Context, queryConfig *core.QueryConfig) ([]core.IndexInfo, error) {
+	infos, err := s.client.ResolveIndices(ctx, queryConfig)
+	if core.IsForbidden(err) {
+		slog.Warn("resolve indices forbidden, skipped", slog.String("error", err.Error()))
+	} else if err != nil {
+		return nil, err
+	}
+	if !queryConfig.HasTimeMapping() {
+		mapping, err := s.client.TimeMapping(ctx, queryConfig)
+		if err != nil {
+			slog.Warn("read time field mapping error", slog.String("error", err.Error()))
+		} else if err := queryConfig.SetTimeMapping(mapping); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.client.ValidateQuery(ctx, queryConfig); err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 && err == nil {
+		slog.Warn("no index matches", slog.String("index", s.index))
+	}
+	for _, info := range infos {
+		slog.Info("target index",
+			slog.String("index", info.Index),
+			slog.String("status", info.Status),
+			slog.Int64("docs", info.Docs),
+		)
+	}
+	return infos, nil
+}
+
+func (s *Scheduler) initOutput(queryConfig *core.QueryConfig) error {
+	if s.checkpoint == nil {
+		return s.outputer.Init()
+	}
+	if s.workers > 1 {
+		return errors.New("checkpoint requires a single worker")
+	}
+	if !s.resume {
+		return s.outputer.Init()
+	}
+	saved, err := core.LoadCheckpoint(s.checkpoint.path)
 	if err != nil {
 		return err
 	}
-	if engine == nil {
-		return nil
+	if saved == nil {
+		return s.outputer.Init()
 	}
-	if err := engine.Run(ctx); err != nil {
+	if !saved.End.Equal(s.endTime) {
+		return fmt.Errorf("checkpoint ends at %v, but the dump ends at %v", saved.End, s.endTime)
+	}
+	resumable, ok := s.outputer.(outputer.Resumable)
+	if !ok {
+		return errors.New("outputer can not resume from a checkpoint")
+	}
+	if err := resumable.Resume(saved.Offset); err != nil {
 		return err
 	}
+	queryConfig.With(core.WithResume(saved))
+	s.checkpoint.state = saved
+	slog.Info("resume dump", slog.Time("from", saved.Start), slog.Int64("rows", saved.Rows))
 	return nil
 }
 
+// finish reports the errors of the run and settles the checkpoint: it is kept
+// when the dump was interrupted or failed and removed once the dump completed.
+func (s *Scheduler) finish(ctx context.Context, runErr error) error {
+	err := ctx.Err()
+	if closer, ok := s.iter.(interface{ Close() }); ok {
+		closer.Close()
+	}
+	if s.iter != nil && s.iter.Err() != nil {
+		err = s.iter.Err()
+	}
+	err = errors.Join(err, runErr)
+	if err == nil && s.incremental != nil {
+		err = s.incremental.save()
+	}
+	if s.checkpoint == nil {
+		return err
+	}
+	if err != nil {
+		return errors.Join(err, s.checkpoint.save())
+	}
+	return s.checkpoint.remove()
+}
+
+// failures keeps the errors of the transform and load stages, which the etl
+// engine only logs.
+type failures struct {
+	mux  sync.Mutex
+	errs []error
+}
+
+func (f *failures) add(err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func (f *failures) err() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return errors.Join(f.errs...)
+}
+
 func (s *Scheduler) BuildWithETL(
 	queryConfig *core.QueryConfig, transformFunc etl.TransformFunc[E, L], total uint64,
 	opts ...etl.Option[E, L],
 ) (ins *etl.ETL[E, L], err error) {
 	etractFunc := func(ctx context.Context) (etl.Iterator[E], error) {
-		return core.NewQueryIterator(ctx, s.client, queryConfig), nil
+		if s.workers <= 1 {
+			s.iter = core.NewQueryIterator(ctx, s.client, queryConfig)
+			return s.iter, nil
+		}
+		queries, err := s.splitQuery(ctx, queryConfig)
+		if err != nil {
+			return nil, err
+		}
+		s.iter = core.NewParallelIterator(ctx, s.client, queries, s.workers, s.ordered)
+		return s.iter, nil
+	}
+
+	if s.checkpoint != nil {
+		// batches leave the transform stage out of order
+		return nil, errors.New("checkpoint requires an ordered run, use RunETL")
+	}
+	s.failures = new(failures)
+	loadFunc := s.outputer.Load
+	if s.incremental != nil {
+		loadFunc = s.incremental.wrap(queryConfig, loadFunc)
 	}
 
 	ins = etl.New(
 		etractFunc,
-		transformFunc,
-		s.outputer.Load,
+		func(batch []E) ([]L, error) {
+			target, err := transformFunc(batch)
+			if err != nil {
+				s.failures.add(err)
+			}
+			return target, err
+		},
+		func(batch []L) (int, error) {
+			n, err := loadFunc(batch)
+			if err != nil {
+				s.failures.add(err)
+			}
+			return n, err
+		},
 		append(
 			[]etl.Option[E, L]{
 				etl.WithReporter[E, L](etl.ProgressReporterFactory(total)),
@@ -187,6 +605,38 @@ func (s *Scheduler) BuildWithETL(
 	return ins, nil
 }
 
+func (s *Scheduler) splitQuery(ctx context.Context, queryConfig *core.QueryConfig) ([]*core.QueryConfig, error) {
+	var windows []core.TimeWindow
+	switch {
+	case s.histogramInterval > 0:
+		var err error
+		windows, err = s.client.SplitByHistogram(ctx, queryConfig, s.histogramInterval, s.workers)
+		if err != nil {
+			return nil, err
+		}
+	case s.windowStep > 0:
+		windows = core.SplitByStep(s.startTime, s.endTime, s.windowStep)
+	default:
+		step := s.endTime.Sub(s.startTime) / time.Duration(s.workers)
+		windows = core.SplitByStep(s.startTime, s.endTime, max(step, time.Second))
+	}
+	if queryConfig.Descending() {
+		// newest window first so ordered output keeps the sort order
+		slices.Reverse(windows)
+	}
+
+	queries := make([]*core.QueryConfig, 0, len(windows))
+	for _, w := range windows {
+		query, err := queryConfig.Window(w.Start, w.End)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	slog.Debug("split query", slog.Int("windows", len(queries)), slog.Int("workers", s.workers))
+	return queries, nil
+}
+
 func (s *Scheduler) Init() error {
 	return s.outputer.Init()
 }
@@ -209,11 +659,22 @@ func (s *Scheduler) handleCondition() *core.ESBody {
 			Bool: core.ESBodyBool{},
 		},
 	}
+	if s.rawBody != nil {
+		body = *s.rawBody
+		body.Query.Bool.Filter = slices.Clone(body.Query.Bool.Filter)
+		body.Query.Bool.Must = slices.Clone(body.Query.Bool.Must)
+		body.Query.Bool.MustNot = slices.Clone(body.Query.Bool.MustNot)
+		body.Query.Bool.Should = slices.Clone(body.Query.Bool.Should)
+	}
 	if s.condition != nil {
 		body.Query.Bool.Filter = append(body.Query.Bool.Filter, s.condition.Filter...)
 		body.Query.Bool.Must = append(body.Query.Bool.Must, s.condition.Must...)
 		body.Query.Bool.MustNot = append(body.Query.Bool.MustNot, s.condition.MustNot...)
 		body.Query.Bool.Should = append(body.Query.Bool.Should, s.condition.Should...)
 	}
+	if len(s.clauses) > 0 {
+		// wrapped so a range on the time field is not taken for the time range
+		body.Query.Bool.Filter = append(body.Query.Bool.Filter, core.M{"bool": core.M{"filter": s.clauses}})
+	}
 	return &body
 }
@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/TCP404/esdumpcore/core"
+	"github.com/TCP404/esdumpcore/internal/estest"
+	"github.com/TCP404/esdumpcore/outputer"
+)
+
+func Test_Scheduler_PreflightForbidden(t *testing.T) {
+	cluster := fakeCluster(t, testHits(10))
+	out := &memOutputer{}
+	s := newTestScheduler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_cat/indices/idx" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"type":"security_exception","reason":"action [indices:monitor/stats] is unauthorized"},"status":403}`))
+			return
+		}
+		cluster(w, r)
+	}, out)
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+	if err := s.RunETL(context.TODO(), query, identity, 10); err != nil {
+		t.Fatalf("RunETL() error = %v", err)
+	}
+	if len(out.rows) != 10 {
+		t.Errorf("RunETL() wrote %v rows, want 10", len(out.rows))
+	}
+}
+
+func Test_Scheduler_ReindexRejected(t *testing.T) {
+	var indices []string
+	target := estest.NewServer(t, estest.BulkHandler(t, func(item estest.BulkItem) estest.BulkResult {
+		indices = append(indices, item.Index)
+		if item.ID == "1" {
+			return estest.BulkResult{Status: 409, Type: "version_conflict_engine_exception", Reason: "exists"}
+		}
+		return estest.BulkResult{}
+	}))
+	cli, err := core.NewClient([]string{target.URL}, "", "", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits := testHits(2)
+	for n := range hits {
+		hits[n].Index = "idx"
+		hits[n].Source = core.M{"n": n}
+	}
+	out := outputer.NewReindex(context.TODO(), cli, "staging-{index}-{time:2006.01.02}")
+	s := newTestScheduler(t, fakeCluster(t, hits), out)
+	query, err := s.BuildQuery()
+	if err != nil {
+		t.Fatalf("BuildQuery() error = %v", err)
+	}
+
+	err = s.RunETL(context.TODO(), query, identity, 2)
+	var itemsErr core.BulkItemsError
+	if !errors.As(err, &itemsErr) || len(itemsErr.Failures) != 1 || itemsErr.Failures[0].ID != "1" {
+		t.Errorf("RunETL() error = %v, want the rejected hit 1", err)
+	}
+	if want := []string{"staging-idx-2024.11.07", "staging-idx-2024.11.07"}; !reflect.DeepEqual(indices, want) {
+		t.Errorf("indexed into %v, want %v", indices, want)
+	}
+}